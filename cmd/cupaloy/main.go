@@ -0,0 +1,274 @@
+// Command cupaloy reviews pending snapshot updates.
+//
+// Running tests with UPDATE_SNAPSHOTS=pending writes the new value of every mismatching snapshot to a
+// file alongside the existing snapshot (with a .new suffix) rather than overwriting it.
+// These pending snapshots can then be reviewed with:
+//   cupaloy review [dir]          interactively accept, reject or skip each pending snapshot
+//   cupaloy accept --all [dir]    accept every pending snapshot
+//   cupaloy accept <file>...      accept the given pending snapshots
+//   cupaloy reject --all [dir]    reject every pending snapshot
+//   cupaloy reject <file>...      reject the given pending snapshots
+// Directories are searched recursively (defaulting to the current directory) for pending snapshots in
+// snapshot directories: those named .snapshots unless another name (or path ending) is given using
+// --dir e.g. --dir testdata/snapshots for snapshots taken using SnapshotSubdirectory("testdata/snapshots").
+// Snapshot headers are left out of the diffs shown by review, which show one line of context around each
+// change unless --context is given.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+const usage = `usage:
+  cupaloy review [--dir snapshot-dir] [--context lines] [dir]
+  cupaloy accept (--all [--dir snapshot-dir] [dir] | <file>...)
+  cupaloy reject (--all [--dir snapshot-dir] [dir] | <file>...)
+`
+
+// defaultSnapshotDir is the name of the directories searched for pending snapshots (the default snapshot
+// subdirectory) unless --dir is given.
+const defaultSnapshotDir = ".snapshots"
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "cupaloy:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("no command given\n" + usage)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "review":
+		return review(args, stdin, stdout)
+	case "accept":
+		return resolveAll(command, args, stdout, accept)
+	case "reject":
+		return resolveAll(command, args, stdout, reject)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", command, usage)
+	}
+}
+
+// pendingSnapshot is a pending update to an existing snapshot file
+type pendingSnapshot struct {
+	snapshotFile string
+	pendingFile  string
+}
+
+func newPendingSnapshot(path string) pendingSnapshot {
+	snapshotFile := strings.TrimSuffix(path, internal.PendingSuffix)
+	return pendingSnapshot{
+		snapshotFile: snapshotFile,
+		pendingFile:  snapshotFile + internal.PendingSuffix,
+	}
+}
+
+// diff shows the changes to the snapshot (ignoring any snapshot headers) with contextLines unchanged lines
+// around each change.
+func (p pendingSnapshot) diff(contextLines int) (string, error) {
+	previous, err := ioutil.ReadFile(p.snapshotFile)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	current, err := ioutil.ReadFile(p.pendingFile)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasSuffix(p.snapshotFile, ".png") {
+		// image snapshots can't be usefully diffed as text but the differing pixels are highlighted in
+		// the diff image written alongside the snapshot
+		return fmt.Sprintf("%s -> %s (see %s)\n", describePNG(previous), describePNG(current),
+			strings.TrimSuffix(p.snapshotFile, ".png")+".diff.png"), nil
+	}
+	return internal.Diff(internal.StripSnapshotHeaders(string(previous)), internal.StripSnapshotHeaders(string(current)), contextLines), nil
+}
+
+func describePNG(data []byte) string {
+	if len(data) == 0 {
+		return "no image"
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "invalid PNG image"
+	}
+	return fmt.Sprintf("PNG image %dx%d", config.Width, config.Height)
+}
+
+func accept(p pendingSnapshot) error {
+	return os.Rename(p.pendingFile, p.snapshotFile)
+}
+
+func reject(p pendingSnapshot) error {
+	return os.Remove(p.pendingFile)
+}
+
+// findPendingSnapshots recursively searches dir for pending snapshots in snapshot directories, which are
+// those whose paths end with snapshotDir. Files elsewhere which happen to have a .new suffix are ignored.
+func findPendingSnapshots(dir string, snapshotDir string) ([]pendingSnapshot, error) {
+	snapshotDir = filepath.Clean(snapshotDir)
+	var pending []pendingSnapshot
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			switch info.Name() {
+			case ".git", "vendor", "node_modules":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(path, internal.PendingSuffix) || !isSnapshotDir(filepath.Dir(path), snapshotDir) {
+			return nil
+		}
+
+		// only files alongside an existing snapshot are pending snapshots
+		p := newPendingSnapshot(path)
+		if _, err := os.Stat(p.snapshotFile); err == nil {
+			pending = append(pending, p)
+		}
+		return nil
+	})
+
+	return pending, err
+}
+
+// isSnapshotDir checks whether the path of a directory ends with the path of the snapshot directory.
+func isSnapshotDir(dir string, snapshotDir string) bool {
+	if dir == snapshotDir {
+		return true
+	}
+	if absolute, err := filepath.Abs(dir); err == nil {
+		dir = absolute
+	}
+	return strings.HasSuffix(dir, string(filepath.Separator)+snapshotDir)
+}
+
+func newFlagSet(command string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	return flags
+}
+
+// parseTargets returns the pending snapshots selected by the arguments to a command: either every
+// pending snapshot in a directory (if --all is passed) or the given files. Any flags specific to the
+// command must already be defined in flags.
+func parseTargets(flags *flag.FlagSet, command string, args []string, all bool) ([]pendingSnapshot, error) {
+	allFlag := flags.Bool("all", false, "select all pending snapshots")
+	snapshotDir := flags.String("dir", defaultSnapshotDir, "the snapshot directories to search")
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("%s\n%s", err, usage)
+	}
+
+	if all || *allFlag {
+		dir := "."
+		switch flags.NArg() {
+		case 0:
+		case 1:
+			dir = flags.Arg(0)
+		default:
+			return nil, fmt.Errorf("at most one directory can be given\n%s", usage)
+		}
+		return findPendingSnapshots(dir, *snapshotDir)
+	}
+
+	if flags.NArg() == 0 {
+		return nil, fmt.Errorf("either --all or the files to %s must be given\n%s", command, usage)
+	}
+
+	var targets []pendingSnapshot
+	for _, arg := range flags.Args() {
+		targets = append(targets, newPendingSnapshot(arg))
+	}
+	return targets, nil
+}
+
+func resolveAll(command string, args []string, stdout io.Writer, resolve func(pendingSnapshot) error) error {
+	targets, err := parseTargets(newFlagSet(command), command, args, false)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if err := resolve(target); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%sed %s\n", command, target.snapshotFile)
+	}
+	return nil
+}
+
+func review(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := newFlagSet("review")
+	contextLines := flags.Int("context", 1, "the number of unchanged lines shown around each change")
+	targets, err := parseTargets(flags, "review", args, true)
+	if err != nil {
+		return err
+	}
+
+	if len(targets) == 0 {
+		fmt.Fprintln(stdout, "no pending snapshots found")
+		return nil
+	}
+
+	input := bufio.NewScanner(stdin)
+	for n, target := range targets {
+		diff, err := target.diff(*contextLines)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "[%d/%d] %s\n%s\n", n+1, len(targets), target.snapshotFile, diff)
+
+		switch ask(input, stdout) {
+		case "a":
+			err = accept(target)
+		case "r":
+			err = reject(target)
+		case "s":
+		default:
+			// quit, leaving the remaining snapshots pending
+			return input.Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ask prompts until a valid choice is entered, returning its first letter or "" at the end of the input.
+func ask(input *bufio.Scanner, stdout io.Writer) string {
+	for {
+		fmt.Fprint(stdout, "(a)ccept, (r)eject, (s)kip or (q)uit? ")
+		if !input.Scan() {
+			fmt.Fprintln(stdout)
+			return ""
+		}
+
+		switch answer := strings.ToLower(strings.TrimSpace(input.Text())); answer {
+		case "a", "accept", "r", "reject", "s", "skip", "q", "quit":
+			return answer[:1]
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setup creates a package containing a snapshot directory with two snapshots, each with a pending update.
+// The path of the snapshot directory is returned.
+func setup(t *testing.T) string {
+	pkg, err := ioutil.TempDir("", "cupaloy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(pkg) })
+
+	dir := filepath.Join(pkg, ".snapshots")
+	files := map[string]string{
+		"TestOne":     "one\n",
+		"TestOne.new": "one updated\n",
+		"TestTwo":     "two\n",
+		"TestTwo.new": "two updated\n",
+		"other.new":   "not a pending snapshot\n",
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "<missing>"
+	}
+	return string(contents)
+}
+
+func TestAcceptAll(t *testing.T) {
+	dir := setup(t)
+	pkg := filepath.Dir(dir)
+	for name, contents := range map[string]string{"config.yaml": "old\n", "config.yaml.new": "new\n"} {
+		if err := ioutil.WriteFile(filepath.Join(pkg, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := run([]string{"accept", "--all", pkg}, nil, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(dir, "TestOne")); got != "one updated\n" {
+		t.Errorf("pending snapshot should have been accepted, got %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "TestTwo.new")); got != "<missing>" {
+		t.Errorf("pending snapshot should have been removed, got %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "other.new")); got == "<missing>" {
+		t.Error("files not alongside a snapshot should be left alone")
+	}
+	if got := readFile(t, filepath.Join(pkg, "config.yaml")); got != "old\n" {
+		t.Errorf("files outside snapshot directories should be left alone, got %q", got)
+	}
+}
+
+func TestAcceptAllSnapshotDir(t *testing.T) {
+	dir := setup(t)
+	pkg := filepath.Dir(dir)
+	if err := run([]string{"accept", "--all", "--dir", "testdata/snapshots", pkg}, nil, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "TestOne")); got != "one\n" {
+		t.Errorf("only the given snapshot directories should be searched, got %q", got)
+	}
+
+	if err := run([]string{"accept", "--all", "--dir", ".snapshots", pkg}, nil, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "TestOne")); got != "one updated\n" {
+		t.Errorf("pending snapshot should have been accepted, got %q", got)
+	}
+}
+
+func TestRejectFile(t *testing.T) {
+	dir := setup(t)
+	if err := run([]string{"reject", filepath.Join(dir, "TestOne.new")}, nil, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(dir, "TestOne")); got != "one\n" {
+		t.Errorf("snapshot should be unchanged, got %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "TestOne.new")); got != "<missing>" {
+		t.Errorf("pending snapshot should have been removed, got %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "TestTwo.new")); got != "two updated\n" {
+		t.Errorf("other pending snapshots should be left alone, got %q", got)
+	}
+}
+
+func TestReview(t *testing.T) {
+	dir := setup(t)
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"review", dir}, strings.NewReader("invalid\nr\na\n"), stdout); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(stdout.String(), "-one\n+one updated\n") {
+		t.Errorf("review should show the diff of each pending snapshot, got:\n%s", stdout)
+	}
+	if got := readFile(t, filepath.Join(dir, "TestOne")); got != "one\n" {
+		t.Errorf("first snapshot should have been rejected, got %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "TestTwo")); got != "two updated\n" {
+		t.Errorf("second snapshot should have been accepted, got %q", got)
+	}
+}
+
+func TestReviewHeaders(t *testing.T) {
+	dir := setup(t)
+	files := map[string]string{
+		"TestHeader":        "--- cupaloy snapshot ---\nformat: 3\nversion: v2.7.0\n---\nfirst\nsecond\nthird\n",
+		"TestHeader.new":    "--- cupaloy snapshot ---\nformat: 3\nversion: v2.8.0\n---\nfirst\nchanged\nthird\n",
+		"foo_test.snap":     "-- TestFoo --\n\\--- cupaloy snapshot ---\nversion: v2.7.0\n\\---\nfoo\n",
+		"foo_test.snap.new": "-- TestFoo --\n\\--- cupaloy snapshot ---\nversion: v2.8.0\n\\---\nfoo updated\n",
+		"TestOne.new":       "one\n",
+		"TestTwo.new":       "two\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"review", "--context", "0", dir}, strings.NewReader("s\ns\ns\ns\n"), stdout); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout.String(), "version") {
+		t.Errorf("review should not diff snapshot headers, got:\n%s", stdout)
+	}
+	if !strings.Contains(stdout.String(), "-second\n+changed\n") || strings.Contains(stdout.String(), "first") ||
+		!strings.Contains(stdout.String(), "-foo\n+foo updated\n") {
+		t.Errorf("review should diff the snapshot contents with the given context, got:\n%s", stdout)
+	}
+}
+
+func TestReviewImage(t *testing.T) {
+	dir := setup(t)
+	for name, size := range map[string]int{"TestImage.png": 2, "TestImage.png.new": 3} {
+		encoded := &bytes.Buffer{}
+		if err := png.Encode(encoded, image.NewNRGBA(image.Rect(0, 0, size, size))); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), encoded.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := run([]string{"review", dir}, strings.NewReader("a\n"), stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "PNG image 2x2 -> PNG image 3x3 (see "+filepath.Join(dir, "TestImage.diff.png")+")") {
+		t.Errorf("review should describe pending images rather than diffing them, got:\n%s", stdout)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"unknown"}, {"accept"}} {
+		if err := run(args, nil, ioutil.Discard); err == nil || !strings.Contains(err.Error(), "usage") {
+			t.Errorf("%v should fail with usage, got %v", args, err)
+		}
+	}
+}
@@ -1,17 +1,42 @@
 package cupaloy
 
+import (
+	"os"
+	"regexp"
+)
+
 // Configurator is a functional option that can be passed to cupaloy.New() to change snapshotting behaviour.
 type Configurator func(*Config)
 
 // EnvVariableName can be used to customize the environment variable that determines whether snapshots
 // should be updated e.g.
 //  cupaloy.New(EnvVariableName("UPDATE"))
-// Will create an instance where snapshots will be updated if the UPDATE environment variable is set.
+// Will create an instance where snapshots will be updated if the UPDATE environment variable is set to
+// e.g. "true" or "1". Alternatively, only some snapshots can be updated by setting it to a comma separated
+// list of patterns matching the names of the snapshots (and so tests) to update e.g.
+//  UPDATE=TestParser*,TestRender/html go test ./...
+// A pattern also matches the snapshots of sub-tests e.g. TestRender matches TestRender/html.
+// If the environment variable is set to "pending" then, rather than being updated, the new value of each
+// mismatching snapshot is written to a separate file (with a .new suffix) to be reviewed using the cupaloy
+// command (github.com/bradleyjkemp/cupaloy/v2/cmd/cupaloy).
+// If the environment variable is set to "migrate" then snapshots which still use the legacy (v1) format are
+// rewritten in the current format, but snapshots are not otherwise updated (see Run for the report printed).
+// If the environment variable is set to "prune" then obsolete snapshots are deleted by Run.
 // Default: UPDATE_SNAPSHOTS
 func EnvVariableName(name string) Configurator {
 	return func(c *Config) {
-		c.shouldUpdate = func() bool {
-			return envVariableSet(name)
+		c.shouldUpdate = func(snapshotName string) bool {
+			return envVariableSet(name) && updateSelected(os.Getenv(name), snapshotName)
+		}
+		c.updateVariable = name
+		c.shouldWritePending = func() bool {
+			return os.Getenv(name) == pendingEnvValue
+		}
+		c.shouldMigrate = func() bool {
+			return os.Getenv(name) == migrateEnvValue
+		}
+		c.shouldPrune = func() bool {
+			return os.Getenv(name) == pruneEnvValue
 		}
 	}
 }
@@ -21,10 +46,25 @@ func EnvVariableName(name string) Configurator {
 //   var update = flag.Bool("update", false, "update snapshots")
 //   cupaloy.New(ShouldUpdate(func () bool { return *update })
 // Will create an instance where snapshots are updated if the --update flag is passed to go test.
-// Default: checks for the presence of the UPDATE_SNAPSHOTS environment variable
+// Default: checks the UPDATE_SNAPSHOTS environment variable (see EnvVariableName)
 func ShouldUpdate(f func() bool) Configurator {
+	return func(c *Config) {
+		c.shouldUpdate = func(string) bool {
+			return f()
+		}
+		c.updateVariable = ""
+	}
+}
+
+// ShouldUpdateSnapshot is similar to ShouldUpdate but the function is passed the name of each snapshot
+// so that only some snapshots can be updated e.g.
+//  cupaloy.New(ShouldUpdateSnapshot(func(name string) bool { return strings.HasPrefix(name, "TestParser") }))
+// For inline snapshots, the name is the file and line of the call to InlineSnapshotT.
+// Default: checks the UPDATE_SNAPSHOTS environment variable (see EnvVariableName)
+func ShouldUpdateSnapshot(f func(snapshotName string) bool) Configurator {
 	return func(c *Config) {
 		c.shouldUpdate = f
+		c.updateVariable = ""
 	}
 }
 
@@ -39,6 +79,49 @@ func SnapshotSubdirectory(name string) Configurator {
 	}
 }
 
+// WithStore sets the Store that snapshots are read from and written to.
+// e.g.
+//  cupaloy.New(cupaloy.WithStore(cupaloy.NewMemoryStore()))
+// Will create an instance where snapshots are only kept in memory.
+// Passing nil restores the default.
+// Default: snapshots are stored in files in the snapshot subdirectory (see SnapshotSubdirectory)
+func WithStore(store Store) Configurator {
+	return func(c *Config) {
+		c.store = store
+	}
+}
+
+// SingleFilePerTestFile controls whether all the snapshots taken by a _test.go file are stored together in
+// a single file in the snapshot subdirectory (named after the test file e.g. "foo_test.snap"), rather than
+// one file per snapshot. This avoids cluttering the snapshot subdirectory when there are many small snapshots.
+// Each snapshot is stored as a separate section of the file and sections are sorted by snapshot name.
+// Default: false
+func SingleFilePerTestFile(singleFilePerTestFile bool) Configurator {
+	return func(c *Config) {
+		c.singleFilePerTestFile = singleFilePerTestFile
+	}
+}
+
+// SnapshotHeader controls whether a header is written at the start of snapshots when they are created or
+// updated. The header records the snapshot format version, the Serializer, the test and source location which
+// took the snapshot and the version of cupaloy e.g.
+//  --- cupaloy snapshot ---
+//  format: 3
+//  serializer: cupaloy.SpewSerializer
+//  test: examples_test.TestFoo
+//  source: advanced_test.go:42
+//  version: v2.8.0
+//  ---
+// The header isn't part of the snapshot itself so changes to it never cause a mismatch. Snapshots with a header
+// are only compared against the current snapshot format, rather than also the legacy (v1) format.
+// Snapshots are read correctly whether or not they have a header, regardless of this option.
+// Default: false
+func SnapshotHeader(snapshotHeader bool) Configurator {
+	return func(c *Config) {
+		c.snapshotHeader = snapshotHeader
+	}
+}
+
 // FailOnUpdate controls whether tests should be failed when snapshots are updated.
 // By default this is true to prevent snapshots being accidentally updated in CI.
 // Default: true
@@ -69,22 +152,79 @@ func FatalOnMismatch(fatalOnMismatch bool) Configurator {
 // SnapshotFileExtension allows you to change the extension of the snapshot files
 // that are written. E.g. if you're snapshotting HTML then adding SnapshotFileExtension(".html")
 // will allow for more easier viewing of snapshots.
-// Default: "", no extension is added.
+// Default: "", no extension is added (unless the Serializer specifies one e.g. JSONSerializer uses ".json").
 func SnapshotFileExtension(snapshotFileExtension string) Configurator {
 	return func(c *Config) {
 		c.snapshotFileExtension = snapshotFileExtension
+		c.snapshotFileExtensionSet = true
+	}
+}
+
+// ImageSnapshots controls whether a single image.Image passed to Snapshot is stored as a PNG file (always
+// separate from other snapshots, even with SingleFilePerTestFile) which is compared pixel by pixel, rather than
+// being serialized like any other value.
+// Default: false
+func ImageSnapshots(imageSnapshots bool) Configurator {
+	return func(c *Config) {
+		c.imageSnapshots = imageSnapshots
+	}
+}
+
+// ImageTolerance controls how closely image snapshots (see Snapshot) must match: each colour channel of a
+// pixel (0-255) may differ by up to channelTolerance, and up to maxDifferentPixels (a fraction of all pixels
+// e.g. 0.01 for 1%) may differ by more than this before the images are considered different. This allows for
+// small differences in e.g. anti-aliasing between platforms.
+// Default: 0, 0 (images must match exactly)
+func ImageTolerance(channelTolerance uint8, maxDifferentPixels float64) Configurator {
+	return func(c *Config) {
+		c.imageChannelTolerance = channelTolerance
+		c.imageMaxDiffPixels = maxDifferentPixels
 	}
 }
 
 // DiffSnapshots allows you to change the diffing function used to display the
 // difference between the previous snapshot and the current.
-// Default: Internal differ using difflib
+// Passing nil restores the default.
+// Default: Internal differ using difflib (unless the Serializer has its own e.g. StructuredSerializer uses StructuralDiff)
 func DiffSnapshots(differ func(previous, current string) string) Configurator {
 	return func(c *Config) {
-		c.diffSnapshots = differ
+		c.diffSnapshots = nil
+		if differ != nil {
+			c.diffSnapshots = func(previous, current string, _ int) string { return differ(previous, current) }
+		}
   }
 }
 
+// DiffSnapshotsWithContext is similar to DiffSnapshots but the differ is also passed the number of unchanged
+// lines to show around each change (see DiffContextLines).
+// WordDiff and CharDiff can be used to highlight changes within lines e.g.
+//  cupaloy.New(cupaloy.DiffSnapshotsWithContext(cupaloy.WordDiff))
+// Passing nil restores the default.
+func DiffSnapshotsWithContext(differ func(previous, current string, contextLines int) string) Configurator {
+	return func(c *Config) {
+		c.diffSnapshots = differ
+	}
+}
+
+// DiffContextLines sets the number of unchanged lines shown around each change in the diff.
+// Default: 1
+func DiffContextLines(lines int) Configurator {
+	return func(c *Config) {
+		c.diffContextLines = lines
+	}
+}
+
+// MaxDiffSize limits the size (in bytes) of the diffs included in errors e.g. when a large snapshot doesn't
+// match. Longer diffs are cut short (at the end of a hunk) and summarized e.g. "37 more hunks, 1204 changed lines"
+// and the full diff is written to a file alongside the snapshot (with a .full.diff extension) whose path is
+// included in the error.
+// Default: 0, diffs are never truncated
+func MaxDiffSize(bytes int) Configurator {
+	return func(c *Config) {
+		c.maxDiffSize = bytes
+	}
+}
+
 // UseStringerMethods invoke String() or Error() methods when available rather than dumping the object.
 // This should probably be disabled by default but is not for backwards compatibility reasons.
 // Default: true
@@ -94,16 +234,90 @@ func UseStringerMethods(useStringerMethods bool) Configurator {
 	}
 }
 
+// HexDumpBytes controls whether byte slices are always stored as a hex dump (in the same format as xxd) by the
+// default Serializer e.g.
+//  00000000: 4865 6c6c 6f00 0102 0304 0506 0708 090a  Hello...........
+// Regardless of this option, byte slices which aren't valid UTF-8 (i.e. binary data) are always stored as a hex dump
+// so that snapshot files remain readable and mismatches are shown as a diff of the lines of the hex dump.
+// Default: false
+func HexDumpBytes(hexDumpBytes bool) Configurator {
+	return func(c *Config) {
+		c.hexDumpBytes = hexDumpBytes
+	}
+}
+
+// WithSerializer sets the Serializer used to convert values into snapshots.
+// e.g.
+//  cupaloy.New(cupaloy.WithSerializer(mySerializer))
+// Will create an instance where all snapshots are taken using mySerializer.
+// Passing nil restores the default.
+// Default: SpewSerializer (configured by UseStringerMethods)
+func WithSerializer(serializer Serializer) Configurator {
+	return func(c *Config) {
+		c.serializer = serializer
+	}
+}
+
+// Redact replaces the values found at the given paths with a placeholder (e.g. "[REDACTED time.Time]")
+// before they are snapshotted. This is useful for values which change on every run e.g.
+//  cupaloy.New(cupaloy.Redact("Resp.Items[*].CreatedAt", "$.meta.requestId"))
+// Paths start with either "$" or the name of the snapshotted value's type (both optional) followed
+// by struct fields (matched by Go name or json/yaml tag name) and map keys separated by dots.
+// Slice, array and map elements can also be selected with [index] or [key], and * matches anything.
+// If a redacted field cannot hold the placeholder (i.e. it isn't a string) then the structs containing
+// it are snapshotted as anonymous struct types.
+// Redact can be used multiple times and panics if a path is invalid.
+// Default: nothing is redacted
+func Redact(paths ...string) Configurator {
+	return func(c *Config) {
+		c.redactor = c.redactor.withPaths(paths...)
+	}
+}
+
+// Scrub replaces all matches of pattern in snapshots with replacement (which can refer to
+// submatches e.g. "${1}" as in regexp.ReplaceAllString). Scrubbing happens after the values
+// have been serialized so is useful for nondeterminism which only appears in the snapshot text e.g.
+//  cupaloy.New(cupaloy.Scrub(regexp.MustCompile(`0x[0-9a-f]+`), "0xPOINTER"))
+// Scrub can be used multiple times and the scrubbers are applied in order.
+// See also ScrubRFC3339Times, ScrubUUIDs, ScrubTempPaths and ScrubLocalhostPorts.
+// Default: nothing is scrubbed
+func Scrub(pattern *regexp.Regexp, replacement string) Configurator {
+	return func(c *Config) {
+		// copy to avoid sharing the underlying array with the Config this was cloned from
+		c.scrubbers = append(c.scrubbers[:len(c.scrubbers):len(c.scrubbers)], scrubber{pattern, replacement})
+	}
+}
+
 // Config provides the same snapshotting functions with additional configuration capabilities.
 type Config struct {
-	shouldUpdate           func() bool
+	shouldUpdate           func(snapshotName string) bool
+	shouldWritePending     func() bool
+	shouldMigrate          func() bool
+	shouldPrune            func() bool
+	updateVariable         string
 	subDirName             string
+	store                  Store
+	singleFilePerTestFile  bool
+	snapshotHeader         bool
 	failOnUpdate           bool
 	createNewAutomatically bool
 	fatalOnMismatch        bool
 	snapshotFileExtension  string
-	diffSnapshots          func(previous, current string) string
+	diffSnapshots          func(previous, current string, contextLines int) string
+	diffContextLines       int
+	maxDiffSize            int
+	imageSnapshots         bool
+	imageChannelTolerance  uint8
+	imageMaxDiffPixels     float64
 	useStringerMethods     bool
+	hexDumpBytes           bool
+	serializer             Serializer
+	redactor               *redactor
+	scrubbers              []scrubber
+
+	// snapshotFileExtensionSet records whether SnapshotFileExtension was used, in which case
+	// it takes precedence over any extension preferred by the Serializer
+	snapshotFileExtensionSet bool
 }
 
 // NewDefaultConfig returns a new Config instance initialised with the same options as
@@ -115,8 +329,7 @@ func NewDefaultConfig() *Config {
 		FailOnUpdate(true),
 		CreateNewAutomatically(true),
 		FatalOnMismatch(false),
-		SnapshotFileExtension(""),
-		DiffSnapshots(diffSnapshots),
+		DiffContextLines(1),
 		UseStringerMethods(true),
 	)
 }
@@ -127,12 +340,30 @@ var Global = NewDefaultConfig()
 func (c *Config) clone() *Config {
 	return &Config{
 		shouldUpdate:           c.shouldUpdate,
+		shouldWritePending:     c.shouldWritePending,
+		shouldMigrate:          c.shouldMigrate,
+		shouldPrune:            c.shouldPrune,
+		updateVariable:         c.updateVariable,
 		subDirName:             c.subDirName,
+		store:                  c.store,
+		singleFilePerTestFile:  c.singleFilePerTestFile,
+		snapshotHeader:         c.snapshotHeader,
 		failOnUpdate:           c.failOnUpdate,
 		createNewAutomatically: c.createNewAutomatically,
 		fatalOnMismatch:        c.fatalOnMismatch,
 		snapshotFileExtension:  c.snapshotFileExtension,
 		diffSnapshots:          c.diffSnapshots,
+		diffContextLines:       c.diffContextLines,
+		maxDiffSize:            c.maxDiffSize,
+		imageSnapshots:         c.imageSnapshots,
+		imageChannelTolerance:  c.imageChannelTolerance,
+		imageMaxDiffPixels:     c.imageMaxDiffPixels,
 		useStringerMethods:     c.useStringerMethods,
+		hexDumpBytes:           c.hexDumpBytes,
+		serializer:             c.serializer,
+		redactor:               c.redactor,
+		scrubbers:              c.scrubbers,
+
+		snapshotFileExtensionSet: c.snapshotFileExtensionSet,
 	}
 }
@@ -1,6 +1,7 @@
 package cupaloy
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -47,6 +48,10 @@ func SnapshotWithName(snapshotName string, i ...interface{}) error {
 //
 // If using snapshots in tests, prefer the SnapshotT function which fails the test
 // directly, rather than requiring your to remember to check the error.
+//
+// With ImageSnapshots(true), a single image.Image is stored as a PNG file (rather than being serialized)
+// and compared pixel by pixel (see ImageTolerance). If it doesn't match, an image highlighting the differing pixels
+// is written next to the snapshot and its path returned as the DiffFile of the ErrSnapshotMismatch.
 func (c *Config) Snapshot(i ...interface{}) error {
 	return c.snapshot(getNameOfCaller(), i...)
 }
@@ -70,10 +75,10 @@ func (c *Config) SnapshotWithName(snapshotName string, i ...interface{}) error {
 // if a new snapshot was created.
 //
 // SnapshotT determines the snapshot file automatically from the name of the test (using
-// the t.Name() function). As a result, SnapshotT can be called at most once per test.
-// If you want to call SnapshotT multiple times in a test, if possible, instead collect the
-// values and call SnapshotT with all values at once. Alternatively, use sub-tests and call
-// SnapshotT once in each.
+// the t.Name() function). If SnapshotT is called multiple times in a test then the later
+// snapshots are numbered e.g. TestFoo, TestFoo-2, TestFoo-3 (this requires t to implement
+// Cleanup, as *testing.T does). The test is failed if a numbered snapshot would collide with
+// the snapshot of another test e.g. that of a sub-test named TestFoo/2.
 //
 // If using snapshots in tests, SnapshotT is preferred over Snapshot and SnapshotMulti.
 func (c *Config) SnapshotT(t TestingT, i ...interface{}) {
@@ -82,8 +87,10 @@ func (c *Config) SnapshotT(t TestingT, i ...interface{}) {
 		return
 	}
 
-	snapshotName := strings.Replace(t.Name(), "/", "-", -1)
-	err := c.snapshot(snapshotName, i...)
+	snapshotName, err := c.numberSnapshot(t, strings.Replace(t.Name(), "/", "-", -1))
+	if err == nil {
+		err = c.snapshot(snapshotName, i...)
+	}
 	if err != nil {
 		if c.fatalOnMismatch {
 			t.Fatal(err)
@@ -108,31 +115,109 @@ func (c *Config) WithOptions(configurators ...Configurator) *Config {
 	return clonedConfig
 }
 
-func (c *Config) snapshot(snapshotName string, i ...interface{}) error {
-	snapshot := c.takeSnapshot(i...)
+func (c *Config) snapshot(snapshotName string, i ...interface{}) (err error) {
+	matchesV1 := false
+	// whether the snapshot was written or updated: with FailOnUpdate(false) this can't be told from err
+	updated := ""
+	snapshotFile := c.snapshotFilePath(snapshotName)
+	defer func() { c.recordOutcome(snapshotName, snapshotFile, err, matchesV1, updated) }()
+
+	if img, ok := snapshotImage(i); ok && c.imageSnapshots {
+		snapshotFile, updated, err = c.imageSnapshot(snapshotName, img)
+		return err
+	}
+	c.recordSnapshotUsed(snapshotName)
+
+	snapshot, err := c.takeSnapshot(i...)
+	if err != nil {
+		return err
+	}
+
+	// prevent parallel tests from racing to read, compare and update the same snapshot
+	unlock, err := lockStoreFile(c.getStore(), c.snapshotFileName(snapshotName))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// nothing is written to the filesystem in strict mode, whatever the Config says
+	strict := c.strict()
 
-	prevSnapshot, err := c.readSnapshot(snapshotName)
-	if os.IsNotExist(err) {
-		if c.createNewAutomatically {
+	prevSnapshot, header, err := c.readSnapshot(snapshotName)
+	if errors.Is(err, os.ErrNotExist) {
+		if c.createNewAutomatically && !strict {
+			updated = outcomeWritten
 			return c.updateSnapshot(snapshotName, prevSnapshot, snapshot)
 		}
-		return internal.ErrNoSnapshot{Name: snapshotName}
+		return internal.ErrNoSnapshot{
+			Name:     snapshotName,
+			FilePath: c.snapshotFilePath(snapshotName),
+			Current:  snapshot,
+			Strict:   strict,
+		}
 	}
 	if err != nil {
 		return err
 	}
 
-	if snapshot == prevSnapshot || c.takeV1Snapshot(i...) == prevSnapshot {
+	// snapshots without a header may have been written in the legacy format
+	mayBeV1 := header == nil || header.Format < 2
+	matchesV1 = snapshot != prevSnapshot && mayBeV1 && c.usesSpewSerializer() && c.takeV1Snapshot(i...) == prevSnapshot
+	// or, before format 3, with binary byte slices written raw rather than as a hex dump
+	mayBeRawBytes := header == nil || header.Format < 3
+	matchesRawBytes := snapshot != prevSnapshot && !matchesV1 && mayBeRawBytes && c.usesSpewSerializer() &&
+		c.takeRawBytesSnapshot(i...) == prevSnapshot
+	if snapshot == prevSnapshot || matchesV1 || matchesRawBytes {
 		// previous snapshot matches current value
+		if strict {
+			return nil
+		}
+		if (matchesV1 || matchesRawBytes) && c.shouldMigrate() {
+			if err := c.migrateSnapshot(snapshotName, snapshot); err != nil {
+				return err
+			}
+		}
+		if err := c.removeFullDiff(snapshotName); err != nil {
+			return err
+		}
+		if c.shouldWritePending() {
+			return c.removePendingSnapshot(snapshotName)
+		}
 		return nil
 	}
 
-	if c.shouldUpdate() {
+	if c.shouldUpdate(snapshotName) && !strict {
 		// updates snapshot to current value and upgrades snapshot format
+		updated = outcomeUpdated
 		return c.updateSnapshot(snapshotName, prevSnapshot, snapshot)
 	}
 
+	diff, diffFile, err := c.limitDiff(snapshotName, c.diff(prevSnapshot, snapshot))
+	if err != nil {
+		return err
+	}
+	if c.shouldWritePending() && !strict {
+		pendingFile, err := c.writePendingSnapshot(snapshotName, snapshot)
+		if err != nil {
+			return err
+		}
+		return internal.ErrSnapshotMismatch{
+			Name:        snapshotName,
+			FilePath:    c.snapshotFilePath(snapshotName),
+			Diff:        diff,
+			Previous:    prevSnapshot,
+			Current:     snapshot,
+			PendingFile: pendingFile,
+			DiffFile:    diffFile,
+		}
+	}
+
 	return internal.ErrSnapshotMismatch{
-		Diff: c.diffSnapshots(prevSnapshot, snapshot),
+		Name:     snapshotName,
+		FilePath: c.snapshotFilePath(snapshotName),
+		Diff:     diff,
+		Previous: prevSnapshot,
+		Current:  snapshot,
+		DiffFile: diffFile,
 	}
 }
@@ -0,0 +1,270 @@
+package cupaloy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// WordDiff is a differ for use with DiffSnapshotsWithContext which shows each changed line once with the
+// changed words marked inline e.g.
+//  ~  "price": [-10-]{+12+},
+// When writing to a terminal the changes are highlighted using colors instead.
+func WordDiff(previous, current string, contextLines int) string {
+	return internal.InlineDiff(previous, current, internal.SplitWords, colorOutput(), contextLines)
+}
+
+// CharDiff is similar to WordDiff but marks the individual characters which changed.
+func CharDiff(previous, current string, contextLines int) string {
+	return internal.InlineDiff(previous, current, internal.SplitChars, colorOutput(), contextLines)
+}
+
+// colorOutput checks whether test output is going to a terminal which supports colors.
+// Colors can be disabled by setting the NO_COLOR environment variable (see https://no-color.org).
+func colorOutput() bool {
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// StructuralDiff is a differ for use with DiffSnapshotsWithContext which reports the path of each value that changed
+// (in the style of go-cmp) rather than a text diff e.g.
+//  Resp.Items[3].Price: 10 -> 12
+//  Resp.Items[4]: (added) -> {"Name":"Apple","Price":3}
+// Snapshots must be JSON, ideally taken with StructuredSerializer (for which this is the default differ)
+// so that values are named after their types. Otherwise the line-based diff (with contextLines unchanged
+// lines around each change) is used.
+func StructuralDiff(previous, current string, contextLines int) string {
+	diff, ok := structuralDiff(previous, current)
+	if !ok {
+		return internal.Diff(previous, current, contextLines)
+	}
+	return diff
+}
+
+func structuralDiff(previous, current string) (string, bool) {
+	previousNodes, err := decodeStructured([]byte(previous))
+	if err != nil {
+		return "", false
+	}
+	currentNodes, err := decodeStructured([]byte(current))
+	if err != nil {
+		return "", false
+	}
+
+	multiple := len(previousNodes) > 1 || len(currentNodes) > 1
+	var changes []string
+	for n := 0; n < len(previousNodes) || n < len(currentNodes); n++ {
+		var root string
+		var previousNode, currentNode interface{}
+		if n < len(previousNodes) {
+			root, previousNode = structuredRoot(previousNodes[n])
+		}
+		if n < len(currentNodes) {
+			var currentRoot string
+			currentRoot, currentNode = structuredRoot(currentNodes[n])
+			if root != "" && root != currentRoot {
+				// a different type of value was snapshotted
+				root, previousNode, currentNode = "$", previousNodes[n], currentNodes[n]
+			} else {
+				root = currentRoot
+			}
+		}
+		if multiple {
+			root = fmt.Sprintf("%s#%d", root, n+1)
+		}
+
+		switch {
+		case n >= len(previousNodes):
+			changes = append(changes, fmt.Sprintf("%s: (added) -> %s", root, formatStructured(currentNode)))
+		case n >= len(currentNodes):
+			changes = append(changes, fmt.Sprintf("%s: %s -> (removed)", root, formatStructured(previousNode)))
+		default:
+			diffStructured(root, previousNode, currentNode, &changes)
+		}
+	}
+
+	if len(changes) == 0 {
+		// the snapshots only differ in their formatting
+		return "", false
+	}
+	return strings.Join(changes, "\n") + "\n", true
+}
+
+var qualifiedIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// structuredRoot returns the name of the root of the paths within a snapshotted value and the value itself.
+// StructuredSerializer stores values under their type, for other snapshots the root is "$".
+func structuredRoot(node interface{}) (string, interface{}) {
+	object, ok := node.(*orderedObject)
+	if !ok || len(object.keys) != 1 {
+		return "$", node
+	}
+
+	typeName := object.keys[0]
+	if !qualifiedIdentifier.MatchString(typeName) {
+		return "$", object.values[0]
+	}
+	return typeName[strings.LastIndex(typeName, ".")+1:], object.values[0]
+}
+
+// diffStructured appends a description of each difference between two decoded values to changes.
+func diffStructured(path string, previous, current interface{}, changes *[]string) {
+	switch previous := previous.(type) {
+	case *orderedObject:
+		if current, ok := current.(*orderedObject); ok {
+			for n, key := range previous.keys {
+				if currentValue, ok := current.get(key); ok {
+					diffStructured(structuredPath(path, key), previous.values[n], currentValue, changes)
+				} else {
+					*changes = append(*changes, fmt.Sprintf("%s: %s -> (removed)", structuredPath(path, key), formatStructured(previous.values[n])))
+				}
+			}
+			for n, key := range current.keys {
+				if _, ok := previous.get(key); !ok {
+					*changes = append(*changes, fmt.Sprintf("%s: (added) -> %s", structuredPath(path, key), formatStructured(current.values[n])))
+				}
+			}
+			return
+		}
+
+	case []interface{}:
+		if current, ok := current.([]interface{}); ok {
+			for n := 0; n < len(previous) || n < len(current); n++ {
+				elementPath := fmt.Sprintf("%s[%d]", path, n)
+				switch {
+				case n >= len(current):
+					*changes = append(*changes, fmt.Sprintf("%s: %s -> (removed)", elementPath, formatStructured(previous[n])))
+				case n >= len(previous):
+					*changes = append(*changes, fmt.Sprintf("%s: (added) -> %s", elementPath, formatStructured(current[n])))
+				default:
+					diffStructured(elementPath, previous[n], current[n], changes)
+				}
+			}
+			return
+		}
+	}
+
+	if formattedPrevious, formattedCurrent := formatStructured(previous), formatStructured(current); formattedPrevious != formattedCurrent {
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, formattedPrevious, formattedCurrent))
+	}
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func structuredPath(path string, key string) string {
+	if identifier.MatchString(key) {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s[%q]", path, key)
+}
+
+// fullDiffSuffix is appended to the name of a snapshot to give the name of the file its full diff is
+// written to when the diff is too long to include in an error (see MaxDiffSize).
+const fullDiffSuffix = ".full.diff"
+
+// limitDiff truncates a diff which is longer than the configured maximum size, writing the full diff to
+// a file alongside the snapshot. The (possibly truncated) diff is returned along with the path of the file
+// containing the full diff (if written).
+func (c *Config) limitDiff(snapshotName string, diff string) (string, string, error) {
+	truncated, summary := truncateDiff(diff, c.maxDiffSize)
+	if summary == "" {
+		return diff, "", c.removeFullDiff(snapshotName)
+	}
+	if c.strict() {
+		return fmt.Sprintf("%s... %s\n", truncated, summary), "", nil
+	}
+
+	diffFile := snapshotName + fullDiffSuffix
+	if err := c.getStore().Write(diffFile, []byte(diff)); err != nil {
+		return "", "", err
+	}
+	diffPath := c.storePath(diffFile)
+	return fmt.Sprintf("%s... %s (full diff written to %s)\n", truncated, summary, diffPath), diffPath, nil
+}
+
+// removeFullDiff removes the full diff written for a snapshot by a previous run (if any).
+func (c *Config) removeFullDiff(snapshotName string) error {
+	if c.maxDiffSize <= 0 || c.strict() {
+		// full diffs are never written
+		return nil
+	}
+
+	// check that the file exists first as the store may be read-only
+	diffFile := snapshotName + fullDiffSuffix
+	if _, err := c.getStore().Read(diffFile); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return c.getStore().Delete(diffFile)
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// truncateDiff cuts a diff short so that it is at most maxSize bytes, keeping whole hunks (or whole lines
+// for diffs without hunks e.g. StructuralDiff), and returns a summary of what was left out.
+// The diff is returned unchanged with an empty summary if it is short enough.
+func truncateDiff(diff string, maxSize int) (string, string) {
+	if maxSize <= 0 || len(diff) <= maxSize {
+		return diff, ""
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n")
+	hasHunks := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			hasHunks = true
+			break
+		}
+	}
+
+	// split the diff into a header (e.g. "--- Previous") followed by hunks
+	var header string
+	var hunks [][]string
+	for _, line := range lines {
+		switch {
+		case !hasHunks || strings.HasPrefix(line, "@@"):
+			hunks = append(hunks, []string{line})
+		case len(hunks) == 0:
+			header += line
+		default:
+			hunks[len(hunks)-1] = append(hunks[len(hunks)-1], line)
+		}
+	}
+
+	truncated := header
+	kept := 0
+	for _, hunk := range hunks {
+		hunkText := strings.Join(hunk, "")
+		if len(truncated)+len(hunkText) > maxSize {
+			break
+		}
+		truncated += hunkText
+		kept++
+	}
+	if truncated != "" && !strings.HasSuffix(truncated, "\n") {
+		truncated += "\n"
+	}
+
+	if !hasHunks {
+		return truncated, fmt.Sprintf("%d more changes", len(hunks)-kept)
+	}
+
+	changedLines := 0
+	for _, hunk := range hunks[kept:] {
+		for _, line := range hunk[1:] {
+			// colored diffs (e.g. from WordDiff) start lines with an escape code
+			line = ansiEscape.ReplaceAllString(line, "")
+			if line != "" && strings.ContainsAny(line[:1], "+-~") {
+				changedLines++
+			}
+		}
+	}
+	return truncated, fmt.Sprintf("%d more hunks, %d changed lines", len(hunks)-kept, changedLines)
+}
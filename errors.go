@@ -0,0 +1,42 @@
+package cupaloy
+
+import (
+	"errors"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// ErrSnapshotCreated is returned when a snapshot did not previously exist and so has been created.
+// Previous is always empty.
+type ErrSnapshotCreated = internal.ErrSnapshotCreated
+
+// ErrSnapshotUpdated is returned when a snapshot did not match and so has been updated to the current value.
+type ErrSnapshotUpdated = internal.ErrSnapshotUpdated
+
+// ErrSnapshotMismatch is returned when a snapshot does not match the current value.
+type ErrSnapshotMismatch = internal.ErrSnapshotMismatch
+
+// ErrNoSnapshot is returned when a snapshot does not exist and has not been created
+// (see CreateNewAutomatically), or could not be created because of strict mode (in which case Strict is true).
+// Previous is always empty.
+type ErrNoSnapshot = internal.ErrNoSnapshot
+
+// IsCreated reports whether err (or any error it wraps) is an ErrSnapshotCreated.
+func IsCreated(err error) bool {
+	return errors.As(err, &ErrSnapshotCreated{})
+}
+
+// IsUpdated reports whether err (or any error it wraps) is an ErrSnapshotUpdated.
+func IsUpdated(err error) bool {
+	return errors.As(err, &ErrSnapshotUpdated{})
+}
+
+// IsMismatch reports whether err (or any error it wraps) is an ErrSnapshotMismatch.
+func IsMismatch(err error) bool {
+	return errors.As(err, &ErrSnapshotMismatch{})
+}
+
+// IsNoSnapshot reports whether err (or any error it wraps) is an ErrNoSnapshot.
+func IsNoSnapshot(err error) bool {
+	return errors.As(err, &ErrNoSnapshot{})
+}
@@ -2,9 +2,23 @@ package examples_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
 	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/bradleyjkemp/cupaloy/v2/internal"
 
@@ -58,7 +72,10 @@ func TestSnapshotWithName(t *testing.T) {
 // If a snapshot is updated then this returns an error
 // This is to prevent you accidentally updating your snapshots in CI
 func TestUpdate(t *testing.T) {
-	snapshotter := cupaloy.New(cupaloy.EnvVariableName("HOME"))
+	setStrictMode(t, "false")
+	os.Setenv("CUPALOY_EXAMPLE_UPDATE", "true")
+	defer os.Unsetenv("CUPALOY_EXAMPLE_UPDATE")
+	snapshotter := cupaloy.New(cupaloy.EnvVariableName("CUPALOY_EXAMPLE_UPDATE"))
 	defer snapshotter.Snapshot("Hello world") // reset snapshot to known state
 
 	err := snapshotter.Snapshot("Hello world")
@@ -78,6 +95,7 @@ func TestUpdate(t *testing.T) {
 
 // If a snapshot doesn't exist then it is created and an error returned
 func TestMissingSnapshot(t *testing.T) {
+	setStrictMode(t, "false")
 	tempdir, err := ioutil.TempDir(".", "ignored")
 	if err != nil {
 		t.Fatal(err)
@@ -111,6 +129,7 @@ func TestMultipleSnapshots(t *testing.T) {
 
 // Test the ShouldUpdate configurator
 func TestShouldUpdate(t *testing.T) {
+	setStrictMode(t, "false")
 	t.Run("false", func(t *testing.T) {
 		result := "Hello!"
 		err := cupaloy.New(cupaloy.ShouldUpdate(func() bool { return false })).Snapshot(result)
@@ -186,7 +205,10 @@ func TestGlobalCreateNewAutomatically(t *testing.T) {
 }
 
 func TestFailOnUpdate(t *testing.T) {
-	snapshotter := cupaloy.New(cupaloy.EnvVariableName("HOME"), cupaloy.FailOnUpdate(false))
+	setStrictMode(t, "false")
+	os.Setenv("CUPALOY_EXAMPLE_UPDATE", "true")
+	defer os.Unsetenv("CUPALOY_EXAMPLE_UPDATE")
+	snapshotter := cupaloy.New(cupaloy.EnvVariableName("CUPALOY_EXAMPLE_UPDATE"), cupaloy.FailOnUpdate(false))
 
 	err := snapshotter.Snapshot("Hello new world")
 	if err != nil {
@@ -236,3 +258,1135 @@ func TestUseStringerMethods(t *testing.T) {
 		cupaloy.New(cupaloy.UseStringerMethods(false)).SnapshotT(t, s)
 	})
 }
+
+type upperCaseSerializer struct{}
+
+func (upperCaseSerializer) Serialize(i ...interface{}) (string, error) {
+	s, err := cupaloy.SpewSerializer{}.Serialize(i...)
+	return strings.ToUpper(s), err
+}
+
+func TestWithSerializer(t *testing.T) {
+	cupaloy.New(cupaloy.WithSerializer(upperCaseSerializer{})).SnapshotT(t, "This is snapshotted by a custom serializer")
+}
+
+type apiResponse struct {
+	ID     int               `json:"id"`
+	Tags   map[string]string `json:"tags"`
+	Nested json.RawMessage   `json:"nested"`
+}
+
+func TestJSONSerializer(t *testing.T) {
+	snapshotter := cupaloy.New(cupaloy.WithSerializer(cupaloy.JSONSerializer{}))
+
+	t.Run("struct", func(t *testing.T) {
+		snapshotter.SnapshotT(t, apiResponse{
+			ID:     1,
+			Tags:   map[string]string{"b": "<second>", "a": "first"},
+			Nested: json.RawMessage(`{"z":1,"y":[true,null]}`),
+		})
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		snapshotter.SnapshotT(t, json.RawMessage(`{"b":1.50,"a":{"d":2,"c":3}}`), `["json", "string"]`, []byte("not json"))
+	})
+
+	t.Run("extension override", func(t *testing.T) {
+		snapshotter.WithOptions(cupaloy.SnapshotFileExtension(".txt")).SnapshotT(t, map[string]int{"b": 2, "a": 1})
+	})
+}
+
+type deployment struct {
+	Name     string            `yaml:"name"`
+	Replicas int               `yaml:"replicas"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
+	internal string
+}
+
+func TestYAMLSerializer(t *testing.T) {
+	snapshotter := cupaloy.New(cupaloy.WithSerializer(cupaloy.YAMLSerializer{}))
+
+	t.Run("struct", func(t *testing.T) {
+		snapshotter.SnapshotT(t, deployment{
+			Name:     "web",
+			Replicas: 3,
+			Labels:   map[string]string{"tier": "frontend", "app": "web"},
+			internal: "not snapshotted",
+		})
+	})
+
+	t.Run("multi-document", func(t *testing.T) {
+		manifests := "kind: Service\nmetadata: {name: web}\n---\nkind: Deployment\nspec: {replicas: 3}\nmetadata: {name: web}\n"
+		snapshotter.SnapshotT(t, manifests, "plain text")
+	})
+}
+
+type item struct {
+	Name      string
+	CreatedAt time.Time
+}
+
+type resp struct {
+	Items []item
+	Meta  map[string]interface{} `json:"meta"`
+	ID    string
+}
+
+func TestRedact(t *testing.T) {
+	result := resp{
+		Items: []item{{"first", time.Now()}, {"second", time.Now()}},
+		Meta:  map[string]interface{}{"requestId": 12345, "page": 1},
+		ID:    "8d5bd1b4-1fbb-4c0e-a2a3-6b6d7d7e8e5a",
+	}
+	snapshotter := cupaloy.New(cupaloy.Redact("resp.Items[*].CreatedAt", "$.meta.requestId", "ID"))
+
+	t.Run("spew", func(t *testing.T) {
+		snapshotter.SnapshotT(t, result)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		snapshotter.WithOptions(cupaloy.WithSerializer(cupaloy.JSONSerializer{})).SnapshotT(t, &result)
+	})
+}
+
+func TestScrub(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	result := []string{
+		"started at " + time.Now().Format(time.RFC3339Nano),
+		"request 8d5bd1b4-1fbb-4c0e-a2a3-6b6d7d7e8e5a",
+		"wrote " + filepath.Join(os.TempDir(), "cupaloy123456", "output.txt"),
+		"kept /var/tmp/cupaloy123456/output.txt and /home/user/repo/tmp/output.txt",
+		"listening on " + listener.Addr().String(),
+		"also listening on [::1]:54321 and localhost:8080",
+		"build 42",
+	}
+
+	cupaloy.New(
+		cupaloy.ScrubRFC3339Times(),
+		cupaloy.ScrubUUIDs(),
+		cupaloy.ScrubTempPaths(),
+		cupaloy.ScrubLocalhostPorts(),
+		cupaloy.Scrub(regexp.MustCompile(`build \d+`), "build N"),
+	).SnapshotT(t, strings.Join(result, "\n"))
+}
+
+type taggedUser struct {
+	Name      string    `json:"name"`
+	Password  string    `cupaloy:"-" json:"password"`
+	LastLogin time.Time `cupaloy:"redact" json:"lastLogin"`
+	SessionID string    `cupaloy:"Session,redact" json:"session_id"`
+	Friends   []*taggedUser
+}
+
+func TestStructTags(t *testing.T) {
+	user := taggedUser{
+		Name:      "alice",
+		Password:  "hunter2",
+		LastLogin: time.Now(),
+		SessionID: "3f2b",
+		Friends:   []*taggedUser{{Name: "bob", Password: "swordfish", LastLogin: time.Now()}},
+	}
+
+	t.Run("spew", func(t *testing.T) {
+		cupaloy.SnapshotT(t, user)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		cupaloy.New(cupaloy.WithSerializer(cupaloy.JSONSerializer{})).SnapshotT(t, user)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		cupaloy.New(cupaloy.WithSerializer(cupaloy.YAMLSerializer{})).SnapshotT(t, user)
+	})
+}
+
+type taggedStringer struct {
+	Name     string
+	Password string `cupaloy:"-"`
+}
+
+func (s taggedStringer) String() string {
+	return "user " + s.Name
+}
+
+// Struct tags don't stop String methods being used
+func TestStructTagsStringer(t *testing.T) {
+	store := cupaloy.NewMemoryStore()
+	snapshotter := cupaloy.New(cupaloy.WithStore(store))
+	snapshotter.SnapshotWithName("stringer", []taggedStringer{{Name: "alice", Password: "hunter2"}})
+
+	stored, _ := store.Read("stringer")
+	if !strings.Contains(string(stored), "(examples_test.taggedStringer) user alice") {
+		t.Errorf("Expected the String method to be used:\n%s", stored)
+	}
+}
+
+type embeddedCredentials struct {
+	Token string
+}
+
+type Embedded struct {
+	Region string
+}
+
+type taggedEmbedding struct {
+	embeddedCredentials
+	Embedded
+	Secret string `cupaloy:"-"`
+}
+
+// Fields promoted from embedded structs are kept when a struct tag changes the struct
+func TestStructTagsEmbedded(t *testing.T) {
+	value := taggedEmbedding{embeddedCredentials{"abc"}, Embedded{"eu"}, "hunter2"}
+
+	store := cupaloy.NewMemoryStore()
+	cupaloy.New(cupaloy.WithStore(store), cupaloy.WithSerializer(cupaloy.JSONSerializer{})).SnapshotWithName("json", value)
+	stored, _ := store.Read("json.json")
+	if expected := "{\n  \"Region\": \"eu\",\n  \"Token\": \"abc\"\n}\n"; string(stored) != expected {
+		t.Errorf("Expected the embedded fields to be promoted:\n%s", stored)
+	}
+
+	cupaloy.New(cupaloy.WithStore(store)).SnapshotWithName("spew", value)
+	stored, _ = store.Read("spew")
+	if !strings.Contains(string(stored), "(examples_test.taggedEmbedding) {") || strings.Contains(string(stored), "hunter2") {
+		t.Errorf("Expected the original type name and no secret:\n%s", stored)
+	}
+}
+
+// Setting the update environment variable to "pending" writes new snapshots to a separate file for review
+func TestPendingSnapshots(t *testing.T) {
+	setStrictMode(t, "false")
+	tempdir, err := ioutil.TempDir(".", "ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	os.Setenv("CUPALOY_EXAMPLE_PENDING", "pending")
+	defer os.Unsetenv("CUPALOY_EXAMPLE_PENDING")
+	snapshotter := cupaloy.New(cupaloy.EnvVariableName("CUPALOY_EXAMPLE_PENDING"), cupaloy.SnapshotSubdirectory(tempdir))
+
+	snapshotter.SnapshotWithName("pending", "Hello world") // create the snapshot
+
+	err = snapshotter.SnapshotWithName("pending", "Hello new world")
+	mismatch, ok := err.(internal.ErrSnapshotMismatch)
+	if !ok || mismatch.PendingFile == "" {
+		t.Fatalf("Mismatches should be written to a pending file for review: %s", err)
+	}
+
+	pending, err := ioutil.ReadFile(mismatch.PendingFile)
+	if err != nil || string(pending) != "Hello new world\n" {
+		t.Fatalf("The pending file should contain the new snapshot: %q %s", pending, err)
+	}
+
+	if err := snapshotter.SnapshotWithName("pending", "Hello world"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mismatch.PendingFile); !os.IsNotExist(err) {
+		t.Fatal("The pending file is removed once the snapshot matches again")
+	}
+}
+
+// Short snapshots can be kept in the test source itself
+func TestInlineSnapshot(t *testing.T) {
+	cupaloy.InlineSnapshotT(t, "Hello inline world!", cupaloy.Inline(`Hello inline world!`))
+
+	cupaloy.New(cupaloy.WithSerializer(cupaloy.JSONSerializer{})).InlineSnapshotT(t, map[string]int{"b": 2, "a": 1}, cupaloy.Inline(`{
+  "a": 1,
+  "b": 2
+}`))
+}
+
+func TestInlineSnapshotMismatch(t *testing.T) {
+	mockT := &TestingT{}
+	mockT.On("Helper").Return()
+	mockT.On("Failed").Return(false)
+	mockT.On("Error", mock.Anything).Return()
+
+	snapshotter := cupaloy.New(cupaloy.ShouldUpdate(func() bool { return false }))
+	snapshotter.InlineSnapshotT(mockT, "This should fail due to a mismatch", cupaloy.Inline(`Something else`))
+	mockT.AssertCalled(t, "Error", mock.Anything)
+}
+
+// The errors returned describe the snapshot and can be inspected using errors.As or the Is... functions
+func TestExportedErrors(t *testing.T) {
+	setStrictMode(t, "false")
+	tempdir, err := ioutil.TempDir(".", "ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	snapshotter := cupaloy.New(cupaloy.SnapshotSubdirectory(tempdir), cupaloy.ShouldUpdate(func() bool { return false }))
+
+	err = snapshotter.SnapshotWithName("exported", "Hello world")
+	if !cupaloy.IsCreated(err) {
+		t.Fatalf("Error returned will be of type ErrSnapshotCreated: %s", err)
+	}
+
+	err = fmt.Errorf("wrapped: %w", snapshotter.SnapshotWithName("exported", "Hello new world"))
+	var mismatch cupaloy.ErrSnapshotMismatch
+	if !cupaloy.IsMismatch(err) || !errors.As(err, &mismatch) {
+		t.Fatalf("Error returned will be of type ErrSnapshotMismatch: %s", err)
+	}
+	if mismatch.Name != "exported" || mismatch.FilePath != filepath.Join(tempdir, "exported") ||
+		mismatch.Previous != "Hello world\n" || mismatch.Current != "Hello new world\n" {
+		t.Fatalf("ErrSnapshotMismatch describes the snapshot: %#v", mismatch)
+	}
+
+	err = snapshotter.WithOptions(cupaloy.CreateNewAutomatically(false)).SnapshotWithName("missing", "Hello")
+	if !cupaloy.IsNoSnapshot(err) || cupaloy.IsCreated(err) {
+		t.Fatalf("Error returned will be of type ErrNoSnapshot: %s", err)
+	}
+}
+
+// SnapshotT can be called multiple times in a test, later snapshots are numbered
+func TestSnapshotTNumbering(t *testing.T) {
+	cupaloy.SnapshotT(t, "first snapshot")
+	cupaloy.SnapshotT(t, "second snapshot")
+	cupaloy.SnapshotT(t, "third snapshot")
+}
+
+// Snapshots are numbered separately for each snapshot directory
+func TestSnapshotTNumberingDirectories(t *testing.T) {
+	setStrictMode(t, "false")
+	tempdir := t.TempDir()
+	a := cupaloy.New(cupaloy.SnapshotSubdirectory(filepath.Join(tempdir, "outa")), cupaloy.FailOnUpdate(false))
+	b := cupaloy.New(cupaloy.SnapshotSubdirectory(filepath.Join(tempdir, "outb")), cupaloy.FailOnUpdate(false))
+	a.SnapshotT(t, "a")
+	b.SnapshotT(t, "b")
+
+	for _, path := range []string{"outa/TestSnapshotTNumberingDirectories", "outb/TestSnapshotTNumberingDirectories"} {
+		if _, err := os.Stat(filepath.Join(tempdir, path)); err != nil {
+			t.Errorf("snapshot %s should have been written: %s", path, err)
+		}
+	}
+}
+
+// cleanupT is a TestingT which also implements Cleanup (like *testing.T)
+type cleanupT struct {
+	*TestingT
+	cleanups []func()
+}
+
+func (c *cleanupT) Cleanup(f func()) {
+	c.cleanups = append(c.cleanups, f)
+}
+
+func TestSnapshotTNumberingCollision(t *testing.T) {
+	parentT := &cleanupT{TestingT: &TestingT{}}
+	parentT.On("Helper").Return()
+	parentT.On("Failed").Return(false)
+	parentT.On("Name").Return(t.Name())
+
+	// the second call uses TestSnapshotTNumberingCollision-2
+	snapshotter := cupaloy.New(cupaloy.ShouldUpdate(func() bool { return false }))
+	snapshotter.SnapshotT(parentT, "first")
+	snapshotter.SnapshotT(parentT, "second")
+	parentT.AssertNotCalled(t, "Error", mock.Anything)
+
+	// which would also be used by the sub-test TestSnapshotTNumberingCollision/2
+	subT := &cleanupT{TestingT: &TestingT{}}
+	subT.On("Helper").Return()
+	subT.On("Failed").Return(false)
+	subT.On("Name").Return(t.Name() + "/2")
+	subT.On("Error", mock.Anything).Return()
+
+	snapshotter.SnapshotT(subT, "second")
+	subT.AssertCalled(t, "Error", mock.Anything)
+
+	for _, cleanup := range append(parentT.cleanups, subT.cleanups...) {
+		cleanup()
+	}
+
+	// once the tests have finished (e.g. when run again with -count) the snapshot is free to be used again
+	rerunT := &cleanupT{TestingT: &TestingT{}}
+	rerunT.On("Helper").Return()
+	rerunT.On("Failed").Return(false)
+	rerunT.On("Name").Return(t.Name() + "/2")
+	snapshotter.SnapshotT(rerunT, "second")
+	rerunT.AssertNotCalled(t, "Error", mock.Anything)
+	for _, cleanup := range rerunT.cleanups {
+		cleanup()
+	}
+}
+
+// All the snapshots taken by a test file can be stored in a single file
+func TestSingleFilePerTestFile(t *testing.T) {
+	setStrictMode(t, "false")
+	tempdir, err := ioutil.TempDir(".", "ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	snapshotter := cupaloy.New(cupaloy.SnapshotSubdirectory(tempdir), cupaloy.SingleFilePerTestFile(true), cupaloy.FailOnUpdate(false))
+
+	contents := map[string]string{
+		"b-tricky": "-- b-tricky --\n\\ No newline at end of snapshot\n\\escaped\n\n",
+		"a-simple": "Hello world",
+		"c-empty":  "",
+	}
+
+	// snapshots are merged into the file concurrently
+	var wg sync.WaitGroup
+	for name, value := range contents {
+		wg.Add(1)
+		go func(name, value string) {
+			defer wg.Done()
+			if err := snapshotter.SnapshotWithName(name, value); err != nil {
+				t.Error(err)
+			}
+		}(name, value)
+	}
+	wg.Wait()
+
+	snapshotFile := filepath.Join(tempdir, "advanced_test.snap")
+	buf, err := ioutil.ReadFile(snapshotFile)
+	if err != nil {
+		t.Fatal("Snapshots are stored in a file named after the test file:", err)
+	}
+	cupaloy.SnapshotT(t, string(buf))
+
+	snapshotter = snapshotter.WithOptions(cupaloy.ShouldUpdate(func() bool { return false }))
+	for name, value := range contents {
+		if err := snapshotter.SnapshotWithName(name, value); err != nil {
+			t.Errorf("Snapshot %s should match after being read back: %s", name, err)
+		}
+	}
+
+	err = snapshotter.SnapshotWithName("a-simple", "something else")
+	if !cupaloy.IsMismatch(err) {
+		t.Fatalf("Expected a mismatch: %s", err)
+	}
+	if mismatch := err.(cupaloy.ErrSnapshotMismatch); mismatch.FilePath != snapshotFile {
+		t.Fatalf("The mismatch refers to the single snapshot file: %s", mismatch.FilePath)
+	}
+}
+
+// Snapshots can be kept in memory to test code using cupaloy hermetically
+func TestMemoryStore(t *testing.T) {
+	store := cupaloy.NewMemoryStore()
+	snapshotter := cupaloy.New(cupaloy.WithStore(store), cupaloy.ShouldUpdate(func() bool { return false }))
+
+	err := snapshotter.SnapshotWithName("memory", "Hello world")
+	if !cupaloy.IsCreated(err) {
+		t.Fatalf("Expected the snapshot to be created: %s", err)
+	}
+	if err := snapshotter.SnapshotWithName("memory", "Hello world"); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshotter.SnapshotWithName("memory", "Hello new world"); !cupaloy.IsMismatch(err) {
+		t.Fatalf("Expected a mismatch: %s", err)
+	}
+
+	names, err := store.List()
+	if err != nil || len(names) != 1 || names[0] != "memory" {
+		t.Fatalf("Only the snapshot should have been stored: %v %s", names, err)
+	}
+	if _, err := os.Stat(filepath.Join(".snapshots", "memory")); !os.IsNotExist(err) {
+		t.Fatal("Nothing should be written to the filesystem")
+	}
+}
+
+// Snapshots can be read from an fs.FS e.g. an embed.FS
+func TestFSStore(t *testing.T) {
+	snapshots := fstest.MapFS{"TestFSStore": &fstest.MapFile{Data: []byte("Hello world\n")}}
+	snapshotter := cupaloy.New(cupaloy.WithStore(cupaloy.NewFSStore(snapshots)))
+	snapshotter.SnapshotT(t, "Hello world")
+
+	err := snapshotter.SnapshotWithName("missing", "Hello world")
+	if err == nil || cupaloy.IsCreated(err) {
+		t.Fatalf("Snapshots cannot be created in a read-only store: %s", err)
+	}
+}
+
+// Changes within lines can be highlighted using WordDiff or CharDiff
+func TestWordDiff(t *testing.T) {
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+
+	previous := "{\n  \"name\": \"cupaloy\",\n  \"price\": 10,\n  \"tags\": [\"snapshot\", \"testing\"]\n}\n"
+	current := "{\n  \"name\": \"cupaloy\",\n  \"price\": 12,\n  \"tags\": [\"snapshots\", \"testing\"]\n}\n"
+
+	cupaloy.SnapshotT(t, cupaloy.WordDiff(previous, current, 1), cupaloy.CharDiff(previous, current, 1))
+}
+
+type Item struct {
+	Name  string
+	Price int
+}
+
+type Order struct {
+	ID      string
+	Items   []Item
+	Notes   map[string]string
+	created time.Time
+}
+
+// Snapshots taken with StructuredSerializer report mismatches as a structural diff
+func TestStructuralDiff(t *testing.T) {
+	snapshotter := cupaloy.New(
+		cupaloy.WithSerializer(cupaloy.StructuredSerializer{}),
+		cupaloy.WithStore(cupaloy.NewMemoryStore()),
+		cupaloy.FailOnUpdate(false),
+		cupaloy.ShouldUpdate(func() bool { return false }),
+	)
+
+	order := Order{
+		ID:      "order-1",
+		Items:   []Item{{"Apple", 3}, {"Pear", 10}},
+		Notes:   map[string]string{"delivery": "leave by the door"},
+		created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := snapshotter.SnapshotWithName("order", order); err != nil {
+		t.Fatal(err)
+	}
+
+	order.Items[1].Price = 12
+	order.Items = append(order.Items, Item{"Plum", 1})
+	order.Notes = map[string]string{"gift wrap": "yes"}
+	var mismatch cupaloy.ErrSnapshotMismatch
+	if err := snapshotter.SnapshotWithName("order", order); !errors.As(err, &mismatch) {
+		t.Fatalf("Expected a mismatch: %s", err)
+	}
+
+	serialized, err := cupaloy.StructuredSerializer{}.Serialize(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cupaloy.SnapshotT(t, serialized, mismatch.Diff)
+}
+
+// StructuredSerializer replaces cyclic references (via pointers, maps or slices) with a placeholder
+func TestStructuredSerializerCycles(t *testing.T) {
+	m := map[string]interface{}{"name": "map"}
+	m["self"] = m
+	s := []interface{}{"slice", nil}
+	s[1] = s
+
+	serialized, err := cupaloy.StructuredSerializer{}.Serialize(m, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cupaloy.SnapshotT(t, serialized)
+}
+
+// Differs set with DiffSnapshotsWithContext are passed the number of context lines to show
+func TestDiffSnapshotsWithContext(t *testing.T) {
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	snapshotter := cupaloy.New(
+		cupaloy.WithStore(cupaloy.NewMemoryStore()),
+		cupaloy.ShouldUpdate(func() bool { return false }),
+		cupaloy.DiffSnapshotsWithContext(cupaloy.WordDiff),
+		cupaloy.DiffContextLines(0),
+	)
+
+	snapshotter.SnapshotWithName("context", "first line\nsecond line\nthird line\n")
+	var mismatch cupaloy.ErrSnapshotMismatch
+	if err := snapshotter.SnapshotWithName("context", "first line\nchanged line\nthird line\n"); !errors.As(err, &mismatch) {
+		t.Fatalf("Expected a mismatch: %s", err)
+	}
+	if strings.Contains(mismatch.Diff, "first") || strings.Contains(mismatch.Diff, "third") {
+		t.Fatalf("Expected no context lines in the diff:\n%s", mismatch.Diff)
+	}
+
+	// colored diffs are summarized in the same way when truncated
+	colored := func(previous, current string, contextLines int) string {
+		return "@@ -1 +1 @@\n\x1b[31m-old\x1b[0m\n@@ -2 +2 @@\n\x1b[32m+new\x1b[0m\n"
+	}
+	err := snapshotter.WithOptions(cupaloy.DiffSnapshotsWithContext(colored), cupaloy.MaxDiffSize(30)).
+		SnapshotWithName("context", "changed")
+	if !errors.As(err, &mismatch) || !strings.Contains(mismatch.Diff, "1 more hunks, 1 changed lines") {
+		t.Fatalf("Expected the colored lines to be counted: %s", err)
+	}
+}
+
+// Long diffs can be truncated, with the full diff written to a file
+func TestMaxDiffSize(t *testing.T) {
+	setStrictMode(t, "false")
+	tempdir, err := ioutil.TempDir(".", "ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	snapshotter := cupaloy.New(
+		cupaloy.SnapshotSubdirectory(tempdir),
+		cupaloy.ShouldUpdate(func() bool { return false }),
+		cupaloy.DiffContextLines(0),
+		cupaloy.MaxDiffSize(100),
+	)
+
+	var previous, current []string
+	for n := 0; n < 50; n++ {
+		previous = append(previous, fmt.Sprintf("line %d", n))
+		if n%10 == 0 {
+			current = append(current, fmt.Sprintf("changed line %d", n))
+		} else {
+			current = append(current, fmt.Sprintf("line %d", n))
+		}
+	}
+	snapshotter.SnapshotWithName("long", strings.Join(previous, "\n"))
+
+	var mismatch cupaloy.ErrSnapshotMismatch
+	if err := snapshotter.SnapshotWithName("long", strings.Join(current, "\n")); !errors.As(err, &mismatch) {
+		t.Fatalf("Expected a mismatch: %s", err)
+	}
+	if mismatch.DiffFile == "" || !strings.Contains(mismatch.Diff, mismatch.DiffFile) {
+		t.Fatalf("The path of the full diff should be included in the error: %s", mismatch.Diff)
+	}
+	fullDiff, err := ioutil.ReadFile(mismatch.DiffFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cupaloy.SnapshotT(t, strings.Replace(mismatch.Diff, mismatch.DiffFile, "[DIFF FILE]", 1), string(fullDiff))
+
+	if err := snapshotter.SnapshotWithName("long", strings.Join(previous, "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mismatch.DiffFile); !os.IsNotExist(err) {
+		t.Fatal("The full diff is removed once the snapshot matches again")
+	}
+}
+
+// Snapshots can have a header recording how they were taken
+func TestSnapshotHeader(t *testing.T) {
+	store := cupaloy.NewMemoryStore()
+	snapshotter := cupaloy.New(cupaloy.WithStore(store), cupaloy.SnapshotHeader(true), cupaloy.FailOnUpdate(false))
+
+	if err := snapshotter.SnapshotWithName("header", "Hello world"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Read("header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{
+		"--- cupaloy snapshot ---\nformat: 3\n",
+		"serializer: cupaloy.SpewSerializer\n",
+		"test: examples_test.TestSnapshotHeader\n",
+		"source: advanced_test.go:",
+		"---\nHello world\n",
+	} {
+		if !strings.Contains(string(stored), field) {
+			t.Errorf("Header should contain %q:\n%s", field, stored)
+		}
+	}
+
+	// the header isn't part of the snapshot
+	snapshotter = snapshotter.WithOptions(cupaloy.ShouldUpdate(func() bool { return false }), cupaloy.SnapshotHeader(false))
+	if err := snapshotter.SnapshotWithName("header", "Hello world"); err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshots without a header may be in the legacy format...
+	v1Snapshot := "(string) (len=5) \"Hello\"\n"
+	store.Write("legacy", []byte(v1Snapshot))
+	if err := snapshotter.SnapshotWithName("legacy", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	// ...but those with a header are not
+	store.Write("legacy", []byte("--- cupaloy snapshot ---\nformat: 2\n---\n"+v1Snapshot))
+	if err := snapshotter.SnapshotWithName("legacy", "Hello"); !cupaloy.IsMismatch(err) {
+		t.Fatalf("Expected a mismatch: %s", err)
+	}
+}
+
+// Snapshots in the legacy format can be migrated to the current format
+func TestMigrateSnapshots(t *testing.T) {
+	os.Setenv("CUPALOY_EXAMPLE_MIGRATE", "migrate")
+	defer os.Unsetenv("CUPALOY_EXAMPLE_MIGRATE")
+
+	store := cupaloy.NewMemoryStore()
+	snapshotter := cupaloy.New(cupaloy.WithStore(store), cupaloy.EnvVariableName("CUPALOY_EXAMPLE_MIGRATE"))
+	store.Write("legacy", []byte("(string) (len=5) \"Hello\"\n"))
+	store.Write("changed", []byte("(string) (len=5) \"Hello\"\n"))
+
+	if err := snapshotter.SnapshotWithName("legacy", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if migrated, _ := store.Read("legacy"); string(migrated) != "Hello\n" {
+		t.Fatalf("The snapshot should have been migrated: %q", migrated)
+	}
+
+	// snapshots whose values changed are not updated
+	if err := snapshotter.SnapshotWithName("changed", "Goodbye"); !cupaloy.IsMismatch(err) {
+		t.Fatalf("Expected a mismatch: %s", err)
+	}
+	if unchanged, _ := store.Read("changed"); string(unchanged) != "(string) (len=5) \"Hello\"\n" {
+		t.Fatalf("The snapshot should not have been changed: %q", unchanged)
+	}
+}
+
+// Only some snapshots can be updated by setting UPDATE_SNAPSHOTS to patterns matching their names
+func TestSelectiveUpdate(t *testing.T) {
+	os.Setenv("CUPALOY_EXAMPLE_UPDATE", "TestParser*,TestRender/html")
+	defer os.Unsetenv("CUPALOY_EXAMPLE_UPDATE")
+	store := cupaloy.NewMemoryStore()
+	snapshotter := cupaloy.New(cupaloy.WithStore(store), cupaloy.EnvVariableName("CUPALOY_EXAMPLE_UPDATE"))
+
+	updated := map[string]bool{
+		"TestParser":        true,
+		"TestParserErrors":  true,
+		"TestRender-html":   true,
+		"TestRender-html-2": true,
+		"TestRender-text":   false,
+		"TestLexer":         false,
+	}
+	for name, shouldUpdate := range updated {
+		store.Write(name, []byte("old\n"))
+		err := snapshotter.SnapshotWithName(name, "new")
+		if shouldUpdate != cupaloy.IsUpdated(err) {
+			t.Errorf("Snapshot %s should be updated (%t): %s", name, shouldUpdate, err)
+		}
+	}
+
+	snapshotter = cupaloy.New(cupaloy.WithStore(store), cupaloy.ShouldUpdateSnapshot(func(name string) bool {
+		return name == "TestLexer"
+	}))
+	if err := snapshotter.SnapshotWithName("TestLexer", "newer"); !cupaloy.IsUpdated(err) {
+		t.Errorf("Expected the snapshot to be updated: %s", err)
+	}
+	if err := snapshotter.SnapshotWithName("TestRender-text", "newer"); !cupaloy.IsMismatch(err) {
+		t.Errorf("Expected a mismatch: %s", err)
+	}
+}
+
+// cupaloy.Run warns about values of UPDATE_SNAPSHOTS such as "y" which don't select any snapshots
+func TestSelectiveUpdateWarning(t *testing.T) {
+	os.Setenv("CUPALOY_EXAMPLE_SELECT", "y,TestParser,TestRender*")
+	defer os.Unsetenv("CUPALOY_EXAMPLE_SELECT")
+	snapshotter := cupaloy.New(cupaloy.WithStore(cupaloy.NewMemoryStore()), cupaloy.EnvVariableName("CUPALOY_EXAMPLE_SELECT"))
+
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	cupaloy.Run(summaryTestingM(func() int {
+		snapshotter.SnapshotWithName("TestParser", "Hello world")
+		return 1
+	}))
+	w.Close()
+	output, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(output), "cupaloy: CUPALOY_EXAMPLE_SELECT=y didn't match any snapshots") {
+		t.Errorf("Expected a warning about the unmatched pattern: %s", output)
+	}
+	if strings.Contains(string(output), "=TestParser") || strings.Contains(string(output), "=TestRender") {
+		t.Errorf("Only patterns without wildcards which didn't match should be warned about: %s", output)
+	}
+}
+
+// In strict mode (the default in CI) snapshots are never written, whatever the Config says
+func TestStrictMode(t *testing.T) {
+	setStrictMode(t, "true")
+	tempdir := t.TempDir()
+	snapshotter := cupaloy.New(cupaloy.SnapshotSubdirectory(tempdir), cupaloy.ShouldUpdate(func() bool { return true }))
+
+	err := snapshotter.SnapshotWithName("strict", "Hello world")
+	var noSnapshot cupaloy.ErrNoSnapshot
+	if !errors.As(err, &noSnapshot) || !noSnapshot.Strict {
+		t.Fatalf("Expected the missing snapshot to fail in strict mode: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tempdir, "strict"), []byte("Hello world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshotter.SnapshotWithName("strict", "Hello new world"); !cupaloy.IsMismatch(err) {
+		t.Fatalf("Expected a mismatch rather than an update: %s", err)
+	}
+	if files, _ := ioutil.ReadDir(tempdir); len(files) != 1 {
+		t.Fatalf("Nothing should have been written: %d files", len(files))
+	}
+
+	// strict mode only protects the filesystem
+	store := cupaloy.NewMemoryStore()
+	snapshotter = cupaloy.New(cupaloy.WithStore(store), cupaloy.ShouldUpdate(func() bool { return true }))
+	if err := snapshotter.SnapshotWithName("strict", "Hello world"); !cupaloy.IsCreated(err) {
+		t.Fatalf("Expected the snapshot to be created in the memory store: %s", err)
+	}
+}
+
+// An empty CUPALOY_STRICT is treated as unset
+func TestStrictModeEmpty(t *testing.T) {
+	setStrictMode(t, "")
+	setEnv(t, "CI", "false")
+	snapshotter := cupaloy.New(cupaloy.SnapshotSubdirectory(t.TempDir()))
+
+	if err := snapshotter.SnapshotWithName("strict", "Hello world"); !cupaloy.IsCreated(err) {
+		t.Fatalf("Expected the snapshot to be created: %s", err)
+	}
+}
+
+type summaryTestingM func() int
+
+func (m summaryTestingM) Run() int { return m() }
+
+// cupaloy.Run prints a summary of every snapshot taken and optionally appends it to a JSON file
+func TestSnapshotSummary(t *testing.T) {
+	summaryFile, err := filepath.Abs(filepath.Join(t.TempDir(), "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CUPALOY_SUMMARY_JSON", summaryFile)
+	defer os.Unsetenv("CUPALOY_SUMMARY_JSON")
+
+	snapshotter := cupaloy.New(cupaloy.WithStore(cupaloy.NewMemoryStore()))
+	cupaloy.Run(summaryTestingM(func() int {
+		snapshotter.SnapshotWithName("summary", "Hello world")
+		snapshotter.SnapshotWithName("summary", "Hello world")
+		// a failing run so that obsolete snapshots aren't checked
+		return 1
+	}))
+
+	contents, err := ioutil.ReadFile(summaryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary struct {
+		Package string
+		Passed  int
+		Written int
+		Total   int
+	}
+	if err := json.Unmarshal(contents, &summary); err != nil {
+		t.Fatal(err)
+	}
+	// the summary also counts the snapshots taken by every other test so far
+	if summary.Package != "github.com/bradleyjkemp/cupaloy/v2/examples" || summary.Written < 1 || summary.Passed < 1 ||
+		summary.Total < summary.Written+summary.Passed {
+		t.Errorf("Unexpected summary: %s", contents)
+	}
+}
+
+// The outcome of every snapshot can be reported as newline-delimited JSON and JUnit XML
+func TestSnapshotReport(t *testing.T) {
+	reportDir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CUPALOY_REPORT_JSON", filepath.Join(reportDir, "snapshots.json"))
+	defer os.Unsetenv("CUPALOY_REPORT_JSON")
+	os.Setenv("CUPALOY_REPORT_JUNIT", reportDir)
+	defer os.Unsetenv("CUPALOY_REPORT_JUNIT")
+
+	snapshotter := cupaloy.New(cupaloy.WithStore(cupaloy.NewMemoryStore()), cupaloy.ShouldUpdate(func() bool { return false }))
+	cupaloy.Run(summaryTestingM(func() int {
+		snapshotter.SnapshotWithName("report", "Hello world")
+		snapshotter.SnapshotWithName("report", "Hello new world")
+		return 1
+	}))
+
+	contents, err := ioutil.ReadFile(filepath.Join(reportDir, "snapshots.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outcomes []string
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	for decoder.More() {
+		var record struct {
+			Test    string
+			Name    string
+			Outcome string
+			Diff    string
+		}
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(record.Test, "examples_test.TestSnapshotReport") || record.Name != "report" {
+			t.Errorf("Unexpected record: %+v", record)
+		}
+		if record.Outcome == "failed" && !strings.Contains(record.Diff, "+Hello new world") {
+			t.Errorf("The diff should be reported: %+v", record)
+		}
+		outcomes = append(outcomes, record.Outcome)
+	}
+	if strings.Join(outcomes, ",") != "written,failed" {
+		t.Errorf("Unexpected outcomes: %v", outcomes)
+	}
+
+	junit, err := ioutil.ReadFile(filepath.Join(reportDir, "github.com_bradleyjkemp_cupaloy_v2_examples.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(junit), `<failure message="snapshot report does not match">`) ||
+		!strings.Contains(string(junit), `<property name="cupaloy.outcome" value="written"></property>`) {
+		t.Errorf("Unexpected JUnit report:\n%s", junit)
+	}
+}
+
+// Snapshots which are written or updated are counted and reported as such even with FailOnUpdate(false)
+func TestSnapshotOutcomesWithoutFailOnUpdate(t *testing.T) {
+	reportDir, err := filepath.Abs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CUPALOY_REPORT_JSON", filepath.Join(reportDir, "snapshots.json"))
+	defer os.Unsetenv("CUPALOY_REPORT_JSON")
+	os.Setenv("CUPALOY_SUMMARY_JSON", filepath.Join(reportDir, "summary.json"))
+	defer os.Unsetenv("CUPALOY_SUMMARY_JSON")
+
+	snapshotter := cupaloy.New(
+		cupaloy.WithStore(cupaloy.NewMemoryStore()),
+		cupaloy.ShouldUpdate(func() bool { return true }),
+		cupaloy.FailOnUpdate(false),
+		cupaloy.ImageSnapshots(true))
+	// the summary counts the snapshots taken by every other test so far so is written before and after
+	cupaloy.Run(summaryTestingM(func() int { return 1 }))
+	cupaloy.Run(summaryTestingM(func() int {
+		snapshotter.SnapshotWithName("outcome", "Hello world")
+		snapshotter.SnapshotWithName("outcome", "Hello new world")
+		snapshotter.SnapshotWithName("outcome", "Hello new world")
+		snapshotter.SnapshotWithName("image", image.NewNRGBA(image.Rect(0, 0, 2, 2)))
+		return 1
+	}))
+
+	contents, err := ioutil.ReadFile(filepath.Join(reportDir, "snapshots.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outcomes []string
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	for decoder.More() {
+		var record struct {
+			Name    string
+			File    string
+			Outcome string
+		}
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Name == "image" && record.File != "image.png" {
+			t.Errorf("The image snapshot file should be reported: %+v", record)
+		}
+		outcomes = append(outcomes, record.Outcome)
+	}
+	if strings.Join(outcomes, ",") != "written,updated,passed,written" {
+		t.Errorf("Unexpected outcomes: %v", outcomes)
+	}
+
+	contents, err = ioutil.ReadFile(filepath.Join(reportDir, "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type counts struct {
+		Passed  int
+		Written int
+		Updated int
+		Total   int
+	}
+	var before, after counts
+	decoder = json.NewDecoder(bytes.NewReader(contents))
+	if err := decoder.Decode(&before); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&after); err != nil {
+		t.Fatal(err)
+	}
+	taken := counts{after.Passed - before.Passed, after.Written - before.Written, after.Updated - before.Updated, after.Total - before.Total}
+	if taken != (counts{Passed: 1, Written: 2, Updated: 1, Total: 4}) {
+		t.Errorf("Unexpected summary of the snapshots taken: %+v", taken)
+	}
+}
+
+// Images are stored as PNG files and compared pixel by pixel
+func TestImageSnapshot(t *testing.T) {
+	newImage := func(width, height int, changed color.NRGBA) image.Image {
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 100, G: 150, B: 200, A: 255}), image.Point{}, draw.Src)
+		img.SetNRGBA(0, 0, changed)
+		return img
+	}
+	original := color.NRGBA{R: 100, G: 150, B: 200, A: 255}
+
+	store := cupaloy.NewMemoryStore()
+	snapshotter := cupaloy.New(cupaloy.WithStore(store), cupaloy.ShouldUpdate(func() bool { return false }), cupaloy.ImageSnapshots(true))
+	if err := snapshotter.SnapshotWithName("image", newImage(4, 4, original)); !cupaloy.IsCreated(err) {
+		t.Fatalf("Expected the snapshot to be created: %s", err)
+	}
+	if png, _ := store.Read("image.png"); !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Fatal("The image should be stored as a PNG")
+	}
+	if err := snapshotter.SnapshotWithName("image", newImage(4, 4, original)); err != nil {
+		t.Fatal(err)
+	}
+
+	slightlyChanged := newImage(4, 4, color.NRGBA{R: 103, G: 150, B: 200, A: 255})
+	err := snapshotter.SnapshotWithName("image", slightlyChanged)
+	var mismatch cupaloy.ErrSnapshotMismatch
+	if !errors.As(err, &mismatch) || mismatch.DiffFile != "image.diff.png" ||
+		!strings.Contains(mismatch.Diff, "1 of 16 pixels (6.25%) differ") {
+		t.Fatalf("Expected a mismatch with a diff image: %s", err)
+	}
+	if _, err := store.Read("image.diff.png"); err != nil {
+		t.Fatalf("The diff image should have been written: %s", err)
+	}
+
+	tolerant := snapshotter.WithOptions(cupaloy.ImageTolerance(5, 0))
+	if err := tolerant.SnapshotWithName("image", slightlyChanged); err != nil {
+		t.Fatalf("Expected the image to match within the tolerance: %s", err)
+	}
+	if _, err := store.Read("image.diff.png"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("The diff image should have been removed once the image matched: %s", err)
+	}
+
+	tolerant = snapshotter.WithOptions(cupaloy.ImageTolerance(0, 0.1))
+	if err := tolerant.SnapshotWithName("image", newImage(4, 4, color.NRGBA{A: 255})); err != nil {
+		t.Fatalf("Expected the image to match with a few pixels different: %s", err)
+	}
+	if err := tolerant.SnapshotWithName("image", newImage(4, 5, original)); !cupaloy.IsMismatch(err) ||
+		!strings.Contains(err.Error(), "image size differs: 4x4 != 4x5") {
+		t.Fatalf("Expected images of different sizes not to match: %s", err)
+	}
+}
+
+// With UPDATE_SNAPSHOTS=pending, changed images are written to a pending file for review
+func TestImageSnapshotPending(t *testing.T) {
+	os.Setenv("CUPALOY_EXAMPLE_PENDING", "pending")
+	defer os.Unsetenv("CUPALOY_EXAMPLE_PENDING")
+	store := cupaloy.NewMemoryStore()
+	snapshotter := cupaloy.New(cupaloy.WithStore(store), cupaloy.EnvVariableName("CUPALOY_EXAMPLE_PENDING"), cupaloy.ImageSnapshots(true))
+
+	snapshotter.SnapshotWithName("image", image.NewNRGBA(image.Rect(0, 0, 2, 2))) // create the snapshot
+	var mismatch cupaloy.ErrSnapshotMismatch
+	err := snapshotter.SnapshotWithName("image", image.NewNRGBA(image.Rect(0, 0, 3, 3)))
+	if !errors.As(err, &mismatch) || mismatch.PendingFile != "image.png.new" {
+		t.Fatalf("Expected a mismatch with a pending file: %s", err)
+	}
+	if pending, _ := store.Read("image.png.new"); !bytes.HasPrefix(pending, []byte("\x89PNG")) {
+		t.Fatal("The pending image should be stored as a PNG")
+	}
+
+	if err := snapshotter.SnapshotWithName("image", image.NewNRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Read("image.png.new"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("The pending image should have been removed once the image matched: %s", err)
+	}
+}
+
+// A nil image is snapshotted like any other nil value
+func TestNilImageSnapshot(t *testing.T) {
+	var img *image.NRGBA
+	cupaloy.New(cupaloy.ImageSnapshots(true)).SnapshotT(t, img)
+}
+
+// Without ImageSnapshots(true), images are serialized like any other value
+func TestImageSnapshotsOptIn(t *testing.T) {
+	store := cupaloy.NewMemoryStore()
+	cupaloy.New(cupaloy.WithStore(store)).SnapshotWithName("image", image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+
+	if _, err := store.Read("image.png"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("The image should not be stored as a PNG: %s", err)
+	}
+	if stored, _ := store.Read("image"); !strings.Contains(string(stored), "(*image.NRGBA)") {
+		t.Fatalf("The image should be serialized:\n%s", stored)
+	}
+}
+
+// Binary data is stored as a hex dump
+func TestBinarySnapshot(t *testing.T) {
+	store := cupaloy.NewMemoryStore()
+	snapshotter := cupaloy.New(cupaloy.WithStore(store), cupaloy.ShouldUpdate(func() bool { return false }))
+
+	binary := append([]byte("Hello\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a"), 0xff)
+	if err := snapshotter.SnapshotWithName("binary", binary); !cupaloy.IsCreated(err) {
+		t.Fatalf("Expected the snapshot to be created: %s", err)
+	}
+	hexDump := "00000000: 4865 6c6c 6f00 0102 0304 0506 0708 090a  Hello...........\n" +
+		"00000010: ff                                       .\n"
+	if stored, _ := store.Read("binary"); string(stored) != hexDump {
+		t.Fatalf("Binary data should be stored as a hex dump:\n%s", stored)
+	}
+
+	changed := append([]byte("Hello\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a"), 0xfe)
+	err := snapshotter.SnapshotWithName("binary", changed)
+	if !cupaloy.IsMismatch(err) || !strings.Contains(err.Error(), "-00000010: ff  ") || !strings.Contains(err.Error(), "+00000010: fe  ") {
+		t.Fatalf("Expected a mismatch showing the changed line of the hex dump: %s", err)
+	}
+
+	// binary data which was previously stored raw still matches
+	store.Write("raw", append(binary, '\n'))
+	if err := snapshotter.SnapshotWithName("raw", binary); err != nil {
+		t.Fatal(err)
+	}
+
+	// any byte slice can be stored as a hex dump
+	snapshotter = snapshotter.WithOptions(cupaloy.HexDumpBytes(true), cupaloy.ShouldUpdate(func() bool { return true }))
+	if err := snapshotter.SnapshotWithName("text", []byte("Hello")); !cupaloy.IsCreated(err) {
+		t.Fatalf("Expected the snapshot to be created: %s", err)
+	}
+	if stored, _ := store.Read("text"); !strings.HasPrefix(string(stored), "00000000: 4865 6c6c 6f") {
+		t.Fatalf("Expected a hex dump:\n%s", stored)
+	}
+}
+
+// cupaloy.Run deletes obsolete snapshots but never other files in snapshot directories
+func TestPruneObsoleteSnapshots(t *testing.T) {
+	if f := flag.Lookup("test.run"); f != nil && f.Value.String() != "" {
+		t.Skip("obsolete snapshots are only checked when every test is run")
+	}
+	setStrictMode(t, "false")
+	os.Setenv("CUPALOY_EXAMPLE_PRUNE", "prune")
+	defer os.Unsetenv("CUPALOY_EXAMPLE_PRUNE")
+
+	withFixture, err := ioutil.TempDir(".", "ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(withFixture)
+	onlySnapshots, err := ioutil.TempDir(".", "ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(onlySnapshots)
+
+	for _, file := range []string{
+		filepath.Join(withFixture, "obsolete"),
+		filepath.Join(withFixture, "fixture.json"),
+		filepath.Join(withFixture, ".gitkeep"),
+		filepath.Join(onlySnapshots, "obsolete"),
+	} {
+		if err := ioutil.WriteFile(file, []byte("Hello world\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dir := range []string{withFixture, onlySnapshots} {
+		snapshotter := cupaloy.New(cupaloy.SnapshotSubdirectory(dir), cupaloy.EnvVariableName("CUPALOY_EXAMPLE_PRUNE"))
+		snapshotter.SnapshotWithName("used", "Hello world")
+	}
+	// other stores are pruned in the same way
+	store := cupaloy.NewMemoryStore()
+	store.Write("obsolete", []byte("Hello world\n"))
+	cupaloy.New(cupaloy.WithStore(store), cupaloy.EnvVariableName("CUPALOY_EXAMPLE_PRUNE")).SnapshotWithName("used", "Hello world")
+	cupaloy.Run(summaryTestingM(func() int { return 0 }))
+
+	if files, _ := store.List(); len(files) != 1 || files[0] != "used" {
+		t.Errorf("Only the used snapshot should be left in the store: %v", files)
+	}
+
+	for file, shouldExist := range map[string]bool{
+		filepath.Join(withFixture, "used"):         true,
+		filepath.Join(withFixture, "obsolete"):     true,
+		filepath.Join(withFixture, "fixture.json"): true,
+		filepath.Join(withFixture, ".gitkeep"):     true,
+		filepath.Join(onlySnapshots, "used"):       true,
+		filepath.Join(onlySnapshots, "obsolete"):   false,
+	} {
+		if _, err := os.Stat(file); os.IsNotExist(err) == shouldExist {
+			t.Errorf("%s should exist (%t)", file, shouldExist)
+		}
+	}
+}
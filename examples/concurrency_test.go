@@ -0,0 +1,106 @@
+package examples_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy/v2"
+)
+
+// Snapshots can safely be taken by parallel tests, even when they share a snapshot file.
+// Run with -race to check for data races.
+func TestParallelSnapshots(t *testing.T) {
+	setStrictMode(t, "false")
+	tempdir, err := ioutil.TempDir(".", "ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	// lock files are created in the temporary directory
+	lockdir, err := ioutil.TempDir("", "cupaloy-locks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(lockdir)
+	setEnv(t, "TMPDIR", lockdir)
+
+	snapshotter := cupaloy.New(
+		cupaloy.SnapshotSubdirectory(tempdir),
+		cupaloy.ShouldUpdate(func() bool { return true }),
+		cupaloy.FailOnUpdate(false))
+
+	// large enough that a partially written snapshot would be noticed
+	padding := strings.Repeat("padding ", 10000)
+	complete := regexp.MustCompile(`^value \d+ ` + padding + `\n$`)
+
+	t.Run("group", func(t *testing.T) {
+		for n := 0; n < 200; n++ {
+			n := n
+			t.Run(fmt.Sprint(n), func(t *testing.T) {
+				t.Parallel()
+
+				snapshotter.SnapshotT(t, fmt.Sprintf("own snapshot %d", n))
+				snapshotter.SnapshotT(t, fmt.Sprintf("second snapshot %d", n))
+
+				err := snapshotter.SnapshotWithName("shared", fmt.Sprintf("value %d %s", n, padding))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				shared, err := ioutil.ReadFile(filepath.Join(tempdir, "shared"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !complete.Match(shared) {
+					t.Fatalf("Snapshot files are never partially written (got %d bytes)", len(shared))
+				}
+			})
+		}
+	})
+
+	files, err := ioutil.ReadDir(tempdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2*200+1 {
+		t.Fatalf("Every snapshot is written (and no temporary files are left behind), got %d files", len(files))
+	}
+
+	locks, err := ioutil.ReadDir(lockdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 0 {
+		t.Fatalf("Lock files are removed once unlocked, got %d files", len(locks))
+	}
+}
+
+// Snapshots in stores other than the default one are only locked within the process so don't need lock files
+func TestParallelMemorySnapshots(t *testing.T) {
+	// lock files can't be created in a temporary directory which doesn't exist
+	setEnv(t, "TMPDIR", filepath.Join("ignored", "missing"))
+
+	snapshotter := cupaloy.New(
+		cupaloy.WithStore(cupaloy.NewMemoryStore()),
+		cupaloy.ShouldUpdate(func() bool { return true }),
+		cupaloy.FailOnUpdate(false))
+
+	t.Run("group", func(t *testing.T) {
+		for n := 0; n < 20; n++ {
+			n := n
+			t.Run(fmt.Sprint(n), func(t *testing.T) {
+				t.Parallel()
+
+				if err := snapshotter.SnapshotWithName("shared", fmt.Sprintf("value %d", n)); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package examples_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bradleyjkemp/cupaloy/v2"
+)
+
+// cupaloy.Run reports any snapshots which weren't used by any test once all tests have run
+func TestMain(m *testing.M) {
+	os.Exit(cupaloy.Run(m))
+}
+
+// setStrictMode sets CUPALOY_STRICT for the duration of a test e.g. to allow a test which deliberately
+// creates and updates snapshots on the filesystem to run in CI (which enables strict mode).
+func setStrictMode(t *testing.T, strict string) {
+	setEnv(t, "CUPALOY_STRICT", strict)
+}
+
+// setEnv sets an environment variable for the duration of a test, restoring (or unsetting) it afterwards.
+func setEnv(t *testing.T, key string, value string) {
+	previous, set := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if set {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package cupaloy
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// snapshotFormat is the version of the snapshot format written by this version of cupaloy.
+// Version 1 snapshots were always taken using spew (without calling Stringer methods of nested values)
+// and never have a header. Version 2 snapshots wrote byte slices raw even if they weren't valid UTF-8
+// (rather than as a hex dump).
+const snapshotFormat = 3
+
+// encodeSnapshot returns the snapshot as it should be stored: with a header if configured.
+func (c *Config) encodeSnapshot(snapshot string) string {
+	if !c.snapshotHeader {
+		return snapshot
+	}
+
+	caller := callingTestFrame()
+	header := internal.SnapshotHeader{
+		Format:     snapshotFormat,
+		Serializer: fmt.Sprintf("%T", c.getSerializer()),
+		Test:       filepath.Base(caller.Function),
+		Version:    cupaloyVersion(),
+	}
+	if caller.File != "" {
+		header.Source = fmt.Sprintf("%s:%d", filepath.ToSlash(relativePath(caller.File)), caller.Line)
+	}
+	return header.Encode() + snapshot
+}
+
+// cupaloyVersion returns the version of the cupaloy module used by the test binary.
+func cupaloyVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	modulePath := strings.TrimSuffix(cupaloyFunctionPrefix, ".")
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dependency := range info.Deps {
+		if dependency.Path == modulePath {
+			return dependency.Version
+		}
+	}
+	return ""
+}
@@ -0,0 +1,274 @@
+package cupaloy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"reflect"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// Image snapshots are stored as PNG files named after the snapshot (rather than using the Serializer) and
+// when they don't match, an image highlighting the differing pixels is written next to the snapshot.
+const (
+	imageSnapshotExtension = ".png"
+	imageDiffSuffix        = ".diff.png"
+)
+
+// snapshotImage returns the value to snapshot if it is a single image. Nil images (e.g. a nil *image.NRGBA)
+// are snapshotted like any other value.
+func snapshotImage(i []interface{}) (image.Image, bool) {
+	if len(i) != 1 {
+		return nil, false
+	}
+	img, ok := i[0].(image.Image)
+	if !ok {
+		return nil, false
+	}
+	switch v := reflect.ValueOf(img); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+	}
+	return img, true
+}
+
+// imageSnapshot compares an image against its snapshot in the same way as snapshot does for other values
+// except that images match if they differ by no more than the configured ImageTolerance. It returns the path of
+// the snapshot file and, if the snapshot is written, outcomeWritten or outcomeUpdated.
+func (c *Config) imageSnapshot(snapshotName string, img image.Image) (string, string, error) {
+	snapshotFile := snapshotName + imageSnapshotExtension
+	snapshotPath := c.storePath(snapshotFile)
+	c.recordFileUsed(snapshotFile, imageSnapshotExtension, "")
+
+	current := &bytes.Buffer{}
+	if err := png.Encode(current, img); err != nil {
+		return snapshotPath, "", err
+	}
+
+	unlock, err := lockStoreFile(c.getStore(), snapshotFile)
+	if err != nil {
+		return snapshotPath, "", err
+	}
+	defer unlock()
+
+	strict := c.strict()
+	store := c.getStore()
+
+	previous, err := store.Read(snapshotFile)
+	if errors.Is(err, os.ErrNotExist) {
+		if c.createNewAutomatically && !strict {
+			return snapshotPath, outcomeWritten, c.updateImageSnapshot(snapshotName, nil, current.Bytes())
+		}
+		return snapshotPath, "", internal.ErrNoSnapshot{
+			Name:     snapshotName,
+			FilePath: snapshotPath,
+			Current:  describeImage(img),
+			Strict:   strict,
+		}
+	}
+	if err != nil {
+		return snapshotPath, "", err
+	}
+
+	var diff string
+	var diffImage image.Image
+	if !bytes.Equal(previous, current.Bytes()) {
+		diff, diffImage, err = c.compareImages(previous, img)
+		if err != nil {
+			return snapshotPath, "", err
+		}
+	}
+	if diff == "" {
+		if strict {
+			return snapshotPath, "", nil
+		}
+		if err := c.removeImageDiff(snapshotName); err != nil {
+			return snapshotPath, "", err
+		}
+		if c.shouldWritePending() {
+			return snapshotPath, "", c.removePendingImage(snapshotName)
+		}
+		return snapshotPath, "", nil
+	}
+
+	if c.shouldUpdate(snapshotName) && !strict {
+		return snapshotPath, outcomeUpdated, c.updateImageSnapshot(snapshotName, previous, current.Bytes())
+	}
+
+	mismatch := internal.ErrSnapshotMismatch{
+		Name:     snapshotName,
+		FilePath: snapshotPath,
+		Diff:     diff,
+		Previous: describeImageFile(previous),
+		Current:  describeImage(img),
+	}
+	if !strict {
+		diffFile := snapshotName + imageDiffSuffix
+		encoded := &bytes.Buffer{}
+		if err := png.Encode(encoded, diffImage); err != nil {
+			return snapshotPath, "", err
+		}
+		if err := store.Write(diffFile, encoded.Bytes()); err != nil {
+			return snapshotPath, "", err
+		}
+		mismatch.DiffFile = c.storePath(diffFile)
+	}
+	if c.shouldWritePending() && !strict {
+		pendingFile := snapshotFile + internal.PendingSuffix
+		if err := store.Write(pendingFile, current.Bytes()); err != nil {
+			return snapshotPath, "", err
+		}
+		mismatch.PendingFile = c.storePath(pendingFile)
+	}
+	return snapshotPath, "", mismatch
+}
+
+func (c *Config) updateImageSnapshot(snapshotName string, previous []byte, current []byte) error {
+	snapshotFile := snapshotName + imageSnapshotExtension
+	if err := c.getStore().Write(snapshotFile, current); err != nil {
+		return err
+	}
+	if err := c.removeImageDiff(snapshotName); err != nil {
+		return err
+	}
+
+	if !c.failOnUpdate {
+		return nil
+	}
+
+	if previous == nil {
+		return internal.ErrSnapshotCreated{
+			Name:     snapshotName,
+			FilePath: c.storePath(snapshotFile),
+			Contents: describeImageFile(current),
+			Current:  describeImageFile(current),
+		}
+	}
+	return internal.ErrSnapshotUpdated{
+		Name:     snapshotName,
+		FilePath: c.storePath(snapshotFile),
+		Diff:     fmt.Sprintf("%s -> %s\n", describeImageFile(previous), describeImageFile(current)),
+		Previous: describeImageFile(previous),
+		Current:  describeImageFile(current),
+	}
+}
+
+// removeImageDiff removes any diff image left over from a previous run.
+func (c *Config) removeImageDiff(snapshotName string) error {
+	store := c.getStore()
+	diffFile := snapshotName + imageDiffSuffix
+	// reading first means nothing is written to (possibly read-only) stores which have no diff image
+	if _, err := store.Read(diffFile); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	err := store.Delete(diffFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// removePendingImage removes any pending image left over from a previous run which is no longer needed
+// because the snapshot now matches.
+func (c *Config) removePendingImage(snapshotName string) error {
+	err := c.getStore().Delete(snapshotName + imageSnapshotExtension + internal.PendingSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// compareImages compares an image against a PNG snapshot, returning a description of the difference
+// and an image highlighting the differing pixels (or an empty description if the images match).
+func (c *Config) compareImages(previous []byte, current image.Image) (string, image.Image, error) {
+	prev, err := png.Decode(bytes.NewReader(previous))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid image snapshot: %w", err)
+	}
+
+	prevBounds, curBounds := prev.Bounds(), current.Bounds()
+	width, height := curBounds.Dx(), curBounds.Dy()
+	if prevBounds.Dx() > width {
+		width = prevBounds.Dx()
+	}
+	if prevBounds.Dy() > height {
+		height = prevBounds.Dy()
+	}
+
+	diffImage := image.NewNRGBA(image.Rect(0, 0, width, height))
+	differing := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			prevPoint, curPoint := prevBounds.Min.Add(image.Pt(x, y)), curBounds.Min.Add(image.Pt(x, y))
+			if !prevPoint.In(prevBounds) || !curPoint.In(curBounds) {
+				// outside one of the images
+				differing++
+				diffImage.SetNRGBA(x, y, diffHighlight)
+				continue
+			}
+
+			prevPixel := color.NRGBAModel.Convert(prev.At(prevPoint.X, prevPoint.Y)).(color.NRGBA)
+			curPixel := color.NRGBAModel.Convert(current.At(curPoint.X, curPoint.Y)).(color.NRGBA)
+			if pixelsDiffer(prevPixel, curPixel, c.imageChannelTolerance) {
+				differing++
+				diffImage.SetNRGBA(x, y, diffHighlight)
+			} else {
+				diffImage.SetNRGBA(x, y, faded(curPixel))
+			}
+		}
+	}
+
+	if prevBounds.Size() != curBounds.Size() {
+		return fmt.Sprintf("image size differs: %dx%d != %dx%d\n",
+			prevBounds.Dx(), prevBounds.Dy(), curBounds.Dx(), curBounds.Dy()), diffImage, nil
+	}
+
+	total := width * height
+	if differing == 0 || total > 0 && float64(differing)/float64(total) <= c.imageMaxDiffPixels {
+		return "", nil, nil
+	}
+	return fmt.Sprintf("image differs: %d of %d pixels (%.2f%%) differ by more than %d (at most %.2f%% may differ)\n",
+		differing, total, 100*float64(differing)/float64(total), c.imageChannelTolerance, 100*c.imageMaxDiffPixels), diffImage, nil
+}
+
+// diffHighlight is the colour of differing pixels in diff images.
+var diffHighlight = color.NRGBA{R: 255, A: 255}
+
+func pixelsDiffer(a, b color.NRGBA, tolerance uint8) bool {
+	return channelDiffers(a.R, b.R, tolerance) || channelDiffers(a.G, b.G, tolerance) ||
+		channelDiffers(a.B, b.B, tolerance) || channelDiffers(a.A, b.A, tolerance)
+}
+
+func channelDiffers(a, b uint8, tolerance uint8) bool {
+	if a > b {
+		return a-b > tolerance
+	}
+	return b-a > tolerance
+}
+
+// faded returns a pale grey version of a pixel so that the highlighted differences stand out.
+func faded(c color.NRGBA) color.NRGBA {
+	gray := color.GrayModel.Convert(c).(color.Gray)
+	pale := 255 - (255-gray.Y)/4
+	return color.NRGBA{R: pale, G: pale, B: pale, A: 255}
+}
+
+func describeImage(img image.Image) string {
+	return fmt.Sprintf("PNG image %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+}
+
+func describeImageFile(data []byte) string {
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "invalid PNG image"
+	}
+	return fmt.Sprintf("PNG image %dx%d", config.Width, config.Height)
+}
@@ -0,0 +1,255 @@
+package cupaloy
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// InlineSnapshot is a snapshot stored in the test source code rather than in a separate file.
+// It is created using Inline.
+type InlineSnapshot struct {
+	snapshot string
+}
+
+// Inline wraps the expected value of an inline snapshot. It should be passed a string literal
+// (initially empty) which cupaloy will rewrite whenever the snapshot is created or updated e.g.
+//  cupaloy.InlineSnapshotT(t, result, cupaloy.Inline(``))
+func Inline(snapshot string) InlineSnapshot {
+	return InlineSnapshot{snapshot: snapshot}
+}
+
+// InlineSnapshotT calls Snapshotter.InlineSnapshotT with the global config.
+func InlineSnapshotT(t TestingT, i interface{}, snapshot InlineSnapshot) {
+	t.Helper()
+	_, file, line, _ := runtime.Caller(1)
+	Global.inlineSnapshotT(t, file, line, i, snapshot)
+}
+
+// InlineSnapshotT is similar to SnapshotT but compares the given value to a snapshot stored
+// in the test source code itself (as the argument to Inline) rather than in a snapshot file.
+// This is more readable for short values. When snapshots are created or updated the string literal
+// passed to Inline is rewritten in the test source file. As each call has a single snapshot, the test is
+// failed if a call made more than once (e.g. in a loop) would write different values.
+func (c *Config) InlineSnapshotT(t TestingT, i interface{}, snapshot InlineSnapshot) {
+	t.Helper()
+	_, file, line, _ := runtime.Caller(1)
+	c.inlineSnapshotT(t, file, line, i, snapshot)
+}
+
+func (c *Config) inlineSnapshotT(t TestingT, file string, line int, i interface{}, expected InlineSnapshot) {
+	t.Helper()
+	if t.Failed() {
+		return
+	}
+
+	err := c.inlineSnapshot(file, line, i, expected)
+	if err != nil {
+		if c.fatalOnMismatch {
+			t.Fatal(err)
+			return
+		}
+		t.Error(err)
+	}
+}
+
+func (c *Config) inlineSnapshot(file string, line int, i interface{}, expected InlineSnapshot) error {
+	snapshot, err := c.takeSnapshot(i)
+	if err != nil {
+		return err
+	}
+	// the trailing newline would be noise at the end of every string literal
+	snapshot = strings.TrimSuffix(snapshot, "\n")
+	name := fmt.Sprintf("%s:%d", file, line)
+
+	if snapshot == expected.snapshot {
+		return nil
+	}
+
+	isNewSnapshot := expected.snapshot == ""
+	strict := strictMode()
+	if isNewSnapshot && strict {
+		return internal.ErrNoSnapshot{
+			Name:     name,
+			FilePath: file,
+			Current:  snapshot,
+			Strict:   true,
+		}
+	}
+	if strict || !(isNewSnapshot && c.createNewAutomatically) && !c.shouldUpdate(name) {
+		return internal.ErrSnapshotMismatch{
+			Name:     name,
+			FilePath: file,
+			Diff:     c.diff(expected.snapshot+"\n", snapshot+"\n"),
+			Previous: expected.snapshot,
+			Current:  snapshot,
+		}
+	}
+
+	if err := rewriteInlineSnapshot(file, line, snapshot); err != nil {
+		if conflict, ok := err.(inlineConflict); ok {
+			return fmt.Errorf("inline snapshot %s was already written with a different value during this run "+
+				"(e.g. by an earlier iteration of a loop or table test): use SnapshotT for values which vary\n%s",
+				name, c.diff(conflict.written+"\n", snapshot+"\n"))
+		}
+		return err
+	}
+
+	if !c.failOnUpdate {
+		return nil
+	}
+
+	if isNewSnapshot {
+		return internal.ErrSnapshotCreated{
+			Name:     name,
+			FilePath: file,
+			Contents: snapshot,
+			Current:  snapshot,
+		}
+	}
+
+	return internal.ErrSnapshotUpdated{
+		Name:     name,
+		FilePath: file,
+		Diff:     c.diff(expected.snapshot+"\n", snapshot+"\n"),
+		Previous: expected.snapshot,
+		Current:  snapshot,
+	}
+}
+
+// inlineEdit records that an inline snapshot ending on afterLine was rewritten, moving all following
+// lines by delta. Line numbers reported by the runtime refer to the source as it was compiled so
+// these are needed to find calls in the rewritten file.
+type inlineEdit struct {
+	afterLine int
+	delta     int
+}
+
+// inlineEdits also records the snapshot written for each call (by file and line as originally compiled) so
+// that a call made again with a different value doesn't silently overwrite the snapshot it wrote.
+var inlineEdits = struct {
+	sync.Mutex
+	files   map[string][]inlineEdit
+	written map[string]string
+}{files: map[string][]inlineEdit{}, written: map[string]string{}}
+
+// inlineConflict is returned by rewriteInlineSnapshot if a different snapshot was already written for the call.
+type inlineConflict struct {
+	written string
+}
+
+func (e inlineConflict) Error() string {
+	return fmt.Sprintf("inline snapshot already written as %q", e.written)
+}
+
+// rewriteInlineSnapshot replaces the argument of the Inline call in the call to InlineSnapshotT at the
+// given line (as originally compiled) of file.
+func rewriteInlineSnapshot(file string, line int, snapshot string) error {
+	inlineEdits.Lock()
+	defer inlineEdits.Unlock()
+
+	call := fmt.Sprintf("%s:%d", file, line)
+	if written, ok := inlineEdits.written[call]; ok {
+		if written != snapshot {
+			return inlineConflict{written: written}
+		}
+		// already rewritten
+		return nil
+	}
+
+	for _, edit := range inlineEdits.files[file] {
+		if edit.afterLine < line {
+			line += edit.delta
+		}
+	}
+
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	literal := findInlineSnapshotLiteral(fset, parsed, line)
+	if literal == nil {
+		return fmt.Errorf("unable to find call to InlineSnapshotT with a string literal passed to Inline at %s:%d", file, line)
+	}
+
+	oldLines := strings.Count(literal.Value, "\n")
+	afterLine := fset.Position(literal.End()).Line
+	literal.Value = quoteInlineSnapshot(snapshot)
+
+	source := &bytes.Buffer{}
+	if err := format.Node(source, fset, parsed); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(file, source.Bytes()); err != nil {
+		return err
+	}
+
+	inlineEdits.files[file] = append(inlineEdits.files[file], inlineEdit{
+		afterLine: afterLine,
+		delta:     strings.Count(literal.Value, "\n") - oldLines,
+	})
+	inlineEdits.written[call] = snapshot
+	return nil
+}
+
+// findInlineSnapshotLiteral finds the string literal passed to Inline within the call to InlineSnapshotT
+// which spans the given line.
+func findInlineSnapshotLiteral(fset *token.FileSet, file *ast.File, line int) *ast.BasicLit {
+	var literal *ast.BasicLit
+	ast.Inspect(file, func(node ast.Node) bool {
+		if literal != nil {
+			return false
+		}
+
+		call, ok := node.(*ast.CallExpr)
+		if !ok || !isCallTo(call, "InlineSnapshotT") {
+			return true
+		}
+		if fset.Position(call.Pos()).Line > line || fset.Position(call.End()).Line < line {
+			return true
+		}
+
+		for _, arg := range call.Args {
+			inline, ok := arg.(*ast.CallExpr)
+			if !ok || !isCallTo(inline, "Inline") || len(inline.Args) != 1 {
+				continue
+			}
+			if lit, ok := inline.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				literal = lit
+			}
+		}
+		return literal == nil
+	})
+
+	return literal
+}
+
+func isCallTo(call *ast.CallExpr, name string) bool {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name == name
+	case *ast.SelectorExpr:
+		return fun.Sel.Name == name
+	}
+	return false
+}
+
+// quoteInlineSnapshot returns the Go string literal for a snapshot, preferring a raw string literal.
+func quoteInlineSnapshot(snapshot string) string {
+	if strings.ContainsAny(snapshot, "`\r") {
+		return strconv.Quote(snapshot)
+	}
+	return "`" + snapshot + "`"
+}
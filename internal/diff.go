@@ -0,0 +1,18 @@
+package internal
+
+import "github.com/pmezard/go-difflib/difflib"
+
+// Diff returns a unified diff of two snapshots showing the given number of lines of context around changes
+func Diff(previous, current string, context int) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(previous),
+		B:        difflib.SplitLines(current),
+		FromFile: "Previous",
+		FromDate: "",
+		ToFile:   "Current",
+		ToDate:   "",
+		Context:  context,
+	})
+
+	return diff
+}
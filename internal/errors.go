@@ -4,7 +4,11 @@ import "fmt"
 
 type ErrSnapshotCreated struct {
 	Name     string
+	FilePath string
+	// Contents is the same as Current and is kept for backwards compatibility
 	Contents string
+	Previous string
+	Current  string
 }
 
 func (e ErrSnapshotCreated) Error() string {
@@ -12,8 +16,11 @@ func (e ErrSnapshotCreated) Error() string {
 }
 
 type ErrSnapshotUpdated struct {
-	Name string
-	Diff string
+	Name     string
+	FilePath string
+	Diff     string
+	Previous string
+	Current  string
 }
 
 func (e ErrSnapshotUpdated) Error() string {
@@ -21,17 +28,37 @@ func (e ErrSnapshotUpdated) Error() string {
 }
 
 type ErrSnapshotMismatch struct {
-	Diff string
+	Name     string
+	FilePath string
+	Diff     string
+	Previous string
+	Current  string
+	// PendingFile is the path that the new value of the snapshot was written to for review (if any)
+	PendingFile string
+	// DiffFile is the path that the full diff was written to if it was too long to include in Diff (if any)
+	DiffFile string
 }
 
 func (e ErrSnapshotMismatch) Error() string {
+	if e.PendingFile != "" {
+		return fmt.Sprintf("snapshot not equal (new snapshot written to %s for review):\n%s", e.PendingFile, e.Diff)
+	}
 	return fmt.Sprintf("snapshot not equal:\n%s", e.Diff)
 }
 
 type ErrNoSnapshot struct {
-	Name string
+	Name     string
+	FilePath string
+	Previous string
+	Current  string
+	// Strict is true if the snapshot wasn't created because snapshots can't be written in strict mode (e.g. in CI)
+	Strict bool
 }
 
 func (e ErrNoSnapshot) Error() string {
+	if e.Strict {
+		return fmt.Sprintf("snapshot %s missing in CI: snapshots are never created in strict mode "+
+			"(enabled when CI or CUPALOY_STRICT is true), create it locally and commit it", e.Name)
+	}
 	return fmt.Sprintf("snapshot %s does not exist", e.Name)
 }
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The header optionally written at the start of a snapshot e.g.
+//  --- cupaloy snapshot ---
+//  format: 3
+//  serializer: cupaloy.SpewSerializer
+//  test: examples_test.TestFoo
+//  source: advanced_test.go:42
+//  version: v2.8.0
+//  ---
+const (
+	headerStart = "--- cupaloy snapshot ---\n"
+	headerEnd   = "---\n"
+)
+
+// Files containing several snapshots are a sequence of sections, each starting with a header line e.g.
+//  -- TestFoo --
+//  snapshot contents...
+// Contents lines starting with "--" or "\" are escaped by prefixing them with "\".
+const (
+	SectionHeaderPrefix = "-- "
+	SectionHeaderSuffix = " --"
+	EscapePrefix        = `\`
+)
+
+// SnapshotHeader is the metadata stored in a snapshot's header.
+type SnapshotHeader struct {
+	Format     int
+	Serializer string
+	Test       string
+	Source     string
+	Version    string
+}
+
+// ParseSnapshotHeader splits a stored snapshot into its header (nil if it has none) and its contents.
+func ParseSnapshotHeader(stored string) (*SnapshotHeader, string) {
+	if !strings.HasPrefix(stored, headerStart) {
+		return nil, stored
+	}
+
+	end := strings.Index(stored[len(headerStart):], "\n"+headerEnd)
+	if end < 0 {
+		// not a header after all
+		return nil, stored
+	}
+	fields, contents := stored[len(headerStart):len(headerStart)+end], stored[len(headerStart)+end+len("\n"+headerEnd):]
+
+	header := &SnapshotHeader{}
+	for _, line := range strings.Split(fields, "\n") {
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		// unknown fields are ignored so that headers written by newer versions can be read
+		switch key, value := parts[0], parts[1]; key {
+		case "format":
+			header.Format, _ = strconv.Atoi(value)
+		case "serializer":
+			header.Serializer = value
+		case "test":
+			header.Test = value
+		case "source":
+			header.Source = value
+		case "version":
+			header.Version = value
+		}
+	}
+	return header, contents
+}
+
+// Encode returns the header as it is written at the start of a snapshot.
+func (h SnapshotHeader) Encode() string {
+	encoded := &strings.Builder{}
+	encoded.WriteString(headerStart)
+	fmt.Fprintf(encoded, "format: %d\n", h.Format)
+	for _, field := range []struct{ key, value string }{
+		{"serializer", h.Serializer},
+		{"test", h.Test},
+		{"source", h.Source},
+		{"version", h.Version},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(encoded, "%s: %s\n", field.key, field.value)
+		}
+	}
+	encoded.WriteString(headerEnd)
+	return encoded.String()
+}
+
+// StripSnapshotHeaders removes the headers from a snapshot file so that only the snapshot contents are
+// compared: either the header at the start of the file or, for files containing several snapshots, the
+// (escaped) header at the start of each section.
+func StripSnapshotHeaders(stored string) string {
+	if _, contents := ParseSnapshotHeader(stored); contents != stored {
+		return contents
+	}
+
+	escapedStart, escapedEnd := EscapePrefix+headerStart, EscapePrefix+headerEnd
+	lines := strings.SplitAfter(stored, "\n")
+	stripped := &strings.Builder{}
+	for n := 0; n < len(lines); n++ {
+		stripped.WriteString(lines[n])
+		isSection := strings.HasPrefix(lines[n], SectionHeaderPrefix) && strings.HasSuffix(lines[n], SectionHeaderSuffix+"\n")
+		if !isSection || n+1 >= len(lines) || lines[n+1] != escapedStart {
+			continue
+		}
+		for end := n + 2; end < len(lines); end++ {
+			if lines[end] == escapedEnd {
+				n = end
+				break
+			}
+		}
+	}
+	return stripped.String()
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// ANSI escape codes used when diffs are colored
+const (
+	red          = "\x1b[31m"
+	green        = "\x1b[32m"
+	redReverse   = "\x1b[7;31m"
+	greenReverse = "\x1b[7;32m"
+	reset        = "\x1b[0m"
+)
+
+// InlineDiff returns a diff of two snapshots in which each changed line is shown once with the changed
+// tokens (as split by split) marked inline as [-removed-]{+added+}, or highlighted with ANSI colors if
+// color is true. Changed lines are prefixed with "~" and context lines are shown around changes.
+func InlineDiff(previous, current string, split func(string) []string, color bool, context int) string {
+	a, b := difflib.SplitLines(previous), difflib.SplitLines(current)
+	groups := difflib.NewMatcherWithJunk(a, b, false, nil).GetGroupedOpCodes(context)
+	if len(groups) == 0 {
+		return ""
+	}
+
+	out := &strings.Builder{}
+	out.WriteString("--- Previous\n+++ Current\n")
+	for _, group := range groups {
+		first, last := group[0], group[len(group)-1]
+		fmt.Fprintf(out, "@@ -%s +%s @@\n", formatRange(first.I1, last.I2), formatRange(first.J1, last.J2))
+
+		for _, op := range group {
+			removed, added := a[op.I1:op.I2], b[op.J1:op.J2]
+			switch op.Tag {
+			case 'e':
+				for _, line := range removed {
+					out.WriteString(" " + line)
+				}
+			case 'd':
+				writeLines(out, "-", removed, color, red)
+			case 'i':
+				writeLines(out, "+", added, color, green)
+			case 'r':
+				// pair up the changed lines, any left over were removed or added entirely
+				paired := len(removed)
+				if len(added) < paired {
+					paired = len(added)
+				}
+				for n := 0; n < paired; n++ {
+					out.WriteString("~" + diffTokens(removed[n], added[n], split, color))
+				}
+				writeLines(out, "-", removed[paired:], color, red)
+				writeLines(out, "+", added[paired:], color, green)
+			}
+		}
+	}
+
+	return out.String()
+}
+
+func writeLines(out *strings.Builder, prefix string, lines []string, color bool, colorCode string) {
+	for _, line := range lines {
+		if color {
+			out.WriteString(colorCode + prefix + strings.TrimSuffix(line, "\n") + reset + "\n")
+		} else {
+			out.WriteString(prefix + line)
+		}
+	}
+}
+
+// diffTokens returns the line current with the tokens changed from previous marked inline.
+func diffTokens(previous, current string, split func(string) []string, color bool) string {
+	a, b := split(strings.TrimSuffix(previous, "\n")), split(strings.TrimSuffix(current, "\n"))
+
+	out := &strings.Builder{}
+	for _, op := range difflib.NewMatcherWithJunk(a, b, false, nil).GetOpCodes() {
+		removed, added := strings.Join(a[op.I1:op.I2], ""), strings.Join(b[op.J1:op.J2], "")
+		switch op.Tag {
+		case 'e':
+			out.WriteString(removed)
+		case 'd':
+			out.WriteString(markRemoved(removed, color))
+		case 'i':
+			out.WriteString(markAdded(added, color))
+		case 'r':
+			out.WriteString(markRemoved(removed, color) + markAdded(added, color))
+		}
+	}
+
+	return out.String() + "\n"
+}
+
+func markRemoved(s string, color bool) string {
+	if color {
+		return redReverse + s + reset
+	}
+	return "[-" + s + "-]"
+}
+
+func markAdded(s string, color bool) string {
+	if color {
+		return greenReverse + s + reset
+	}
+	return "{+" + s + "+}"
+}
+
+// formatRange formats a range of lines in the same way as a unified diff.
+func formatRange(start, stop int) string {
+	length := stop - start
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
+
+// SplitWords splits a line into words (runs of letters, digits and underscores), runs of whitespace
+// and individual punctuation characters.
+func SplitWords(line string) []string {
+	var tokens []string
+	start := 0
+	runes := []rune(line)
+	for n := 1; n <= len(runes); n++ {
+		if n < len(runes) && tokenClass(runes[n]) == tokenClass(runes[start]) && tokenClass(runes[n]) != punctuation {
+			continue
+		}
+		tokens = append(tokens, string(runes[start:n]))
+		start = n
+	}
+	return tokens
+}
+
+// SplitChars splits a line into individual characters.
+func SplitChars(line string) []string {
+	tokens := make([]string, 0, len(line))
+	for _, r := range line {
+		tokens = append(tokens, string(r))
+	}
+	return tokens
+}
+
+const (
+	word = iota
+	space
+	punctuation
+)
+
+func tokenClass(r rune) int {
+	switch {
+	case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+		return word
+	case unicode.IsSpace(r):
+		return space
+	default:
+		return punctuation
+	}
+}
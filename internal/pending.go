@@ -0,0 +1,5 @@
+package internal
+
+// PendingSuffix is appended to the path of a snapshot file to give the path that a pending
+// (i.e. awaiting review) update to that snapshot is written to
+const PendingSuffix = ".new"
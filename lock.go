@@ -0,0 +1,116 @@
+package cupaloy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// tempFilePrefix is the prefix of the temporary files written to snapshot directories while
+// snapshots are being atomically written.
+const tempFilePrefix = ".cupaloy-tmp-"
+
+// fileMutexes holds a mutex for each snapshot file which is locked while the snapshot is being
+// read, compared and written so that parallel tests using the same snapshot don't race.
+// Files are keyed by their absolute path for the default Store and by their storeFile otherwise.
+var fileMutexes = struct {
+	sync.Mutex
+	files map[interface{}]*sync.Mutex
+}{files: map[interface{}]*sync.Mutex{}}
+
+// storeFile identifies a file in a Store other than the default one.
+type storeFile struct {
+	store interface{}
+	name  string
+}
+
+// lockStoreFile locks a snapshot file in store against concurrent use (see lockSnapshotFile). Files in stores
+// other than the default one are only locked within this process as there is no file on the filesystem to lock.
+func lockStoreFile(store Store, name string) (func(), error) {
+	if store, ok := store.(dirStore); ok {
+		return lockSnapshotFile(store.path(name))
+	}
+	return lockMutex(storeFile{storeKey(store), name}), nil
+}
+
+// storeKey identifies a Store other than the default one: pointers by their address (as not every Store is
+// comparable) and other stores by their type.
+func storeKey(store Store) interface{} {
+	if value := reflect.ValueOf(store); value.Kind() == reflect.Ptr {
+		return value.Pointer()
+	}
+	return reflect.TypeOf(store)
+}
+
+// lockSnapshotFile locks a snapshot file against concurrent use both within this process and (where
+// supported) by other processes e.g. test binaries for multiple packages sharing snapshot directories.
+// The returned function must be called to release the lock.
+func lockSnapshotFile(snapshotFile string) (func(), error) {
+	absolute, err := filepath.Abs(snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+
+	unlockMutex := lockMutex(absolute)
+	unlockProcess, err := lockFile(lockFilePath(absolute))
+	if err != nil {
+		unlockMutex()
+		return nil, err
+	}
+
+	return func() {
+		unlockProcess()
+		unlockMutex()
+	}, nil
+}
+
+// lockMutex locks the mutex for a file (see fileMutexes), returning the function which unlocks it.
+func lockMutex(file interface{}) func() {
+	fileMutexes.Lock()
+	mutex, ok := fileMutexes.files[file]
+	if !ok {
+		mutex = &sync.Mutex{}
+		fileMutexes.files[file] = mutex
+	}
+	fileMutexes.Unlock()
+
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// lockFilePath returns the path of the file used to lock a snapshot against other processes.
+// Lock files are kept in the temporary directory so that they don't clutter snapshot directories (and are
+// removed once unlocked).
+func lockFilePath(absoluteSnapshotFile string) string {
+	hash := sha256.Sum256([]byte(absoluteSnapshotFile))
+	return filepath.Join(os.TempDir(), "cupaloy-"+hex.EncodeToString(hash[:8])+".lock")
+}
+
+// writeFileAtomic writes data to a temporary file and then renames it to path so that concurrent
+// readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), tempFilePrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // no-op once the file has been renamed
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	// ioutil.TempFile creates files which are only readable by the current user
+	if err := os.Chmod(temp.Name(), os.FileMode(0644)); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
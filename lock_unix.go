@@ -0,0 +1,46 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package cupaloy
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock on path (creating it if necessary), blocking until it is available.
+// The file is removed again when it is unlocked so that lock files don't accumulate.
+func lockFile(path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, os.FileMode(0666))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		// the file may have been removed (and possibly recreated) by its previous holder while waiting for
+		// the lock, in which case the lock is on a file other processes can no longer see so try again
+		locked, err := f.Stat()
+		if err != nil {
+			syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(path); err != nil || !os.SameFile(locked, current) {
+			syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+			f.Close()
+			continue
+		}
+
+		return func() {
+			// removing the file before unlocking it means that nobody can acquire a lock on it once removed
+			os.Remove(path)
+			syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+			f.Close()
+		}, nil
+	}
+}
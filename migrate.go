@@ -0,0 +1,51 @@
+package cupaloy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// migrateEnvValue is the value of the UPDATE_SNAPSHOTS environment variable which causes snapshots in the
+// legacy (v1) format to be rewritten in the current format.
+const migrateEnvValue = "migrate"
+
+// migratedSnapshots records the snapshots migrated during this test run so that they can be reported by Run.
+var migratedSnapshots = struct {
+	sync.Mutex
+	snapshots []string
+}{}
+
+// migrateSnapshot rewrites a snapshot which matched the current value in the legacy format using the current format.
+// The caller must hold the lock on the snapshot file.
+func (c *Config) migrateSnapshot(snapshotName string, snapshot string) error {
+	if err := c.writeSnapshot(snapshotName, snapshot); err != nil {
+		return err
+	}
+
+	migrated := relativePath(c.snapshotFilePath(snapshotName))
+	if c.singleFilePerTestFile {
+		migrated = fmt.Sprintf("%s (%s)", migrated, snapshotName)
+	}
+
+	migratedSnapshots.Lock()
+	defer migratedSnapshots.Unlock()
+	migratedSnapshots.snapshots = append(migratedSnapshots.snapshots, migrated)
+	return nil
+}
+
+func reportMigratedSnapshots(w io.Writer) {
+	migratedSnapshots.Lock()
+	defer migratedSnapshots.Unlock()
+
+	if len(migratedSnapshots.snapshots) == 0 {
+		return
+	}
+
+	sort.Strings(migratedSnapshots.snapshots)
+	fmt.Fprintf(w, "cupaloy: migrated %d snapshot(s) to the current format:\n", len(migratedSnapshots.snapshots))
+	for _, migrated := range migratedSnapshots.snapshots {
+		fmt.Fprintf(w, "  %s\n", migrated)
+	}
+}
@@ -0,0 +1,101 @@
+package cupaloy
+
+import (
+	"fmt"
+	"sync"
+)
+
+// cleanuper is implemented by *testing.T (but not necessarily by other TestingT implementations).
+type cleanuper interface {
+	Cleanup(func())
+}
+
+// snapshotCalls numbers the calls to SnapshotT made by each test so that a test can take multiple
+// snapshots, and records which call each snapshot file belongs to so that collisions can be detected.
+var snapshotCalls = struct {
+	sync.Mutex
+	// counts is the number of calls made so far by each currently running test to each store
+	counts map[snapshotCounter]int
+	// owners is the call that each snapshot was used by (while the test making it is running)
+	owners map[string]snapshotCall
+}{
+	counts: map[snapshotCounter]int{},
+	owners: map[string]snapshotCall{},
+}
+
+// snapshotCounter identifies the calls which are numbered together: those made by a test to the same store
+// (so that a test snapshotting with Configs using different snapshot directories doesn't number them).
+type snapshotCounter struct {
+	store interface{}
+	test  string
+}
+
+// snapshotCall is a numbered call to SnapshotT.
+type snapshotCall struct {
+	counter snapshotCounter
+	call    int
+}
+
+func (s snapshotCall) String() string {
+	return fmt.Sprintf("call %d to SnapshotT in %s", s.call, s.counter.test)
+}
+
+// storeID identifies the store snapshots are written to: the directory for the default store and the
+// storeKey otherwise.
+func (c *Config) storeID() interface{} {
+	store := c.getStore()
+	if _, ok := store.(dirStore); ok {
+		return c.storePath("")
+	}
+	return storeKey(store)
+}
+
+// numberSnapshot returns the name to use for the next snapshot taken by the current test:
+// the first call uses snapshotName unchanged, later calls have "-2", "-3"... appended.
+// An error is returned if the snapshot file was already used by a different call (e.g. a second call
+// in TestFoo uses the same file as the first call in the subtest TestFoo/2).
+func (c *Config) numberSnapshot(t TestingT, snapshotName string) (string, error) {
+	cleanupT, ok := t.(cleanuper)
+	if !ok {
+		// without being able to reset the count when the test finishes, calls can't be numbered reliably
+		return snapshotName, nil
+	}
+
+	snapshotCalls.Lock()
+	defer snapshotCalls.Unlock()
+
+	testName := t.Name()
+	counter := snapshotCounter{store: c.storeID(), test: testName}
+	if snapshotCalls.counts[counter] == 0 {
+		cleanupT.Cleanup(func() {
+			snapshotCalls.Lock()
+			defer snapshotCalls.Unlock()
+			delete(snapshotCalls.counts, counter)
+			// a later run of the test (e.g. with -count) may number its calls differently
+			for snapshotID, owner := range snapshotCalls.owners {
+				if owner.counter == counter {
+					delete(snapshotCalls.owners, snapshotID)
+				}
+			}
+		})
+	}
+	snapshotCalls.counts[counter]++
+
+	call := snapshotCalls.counts[counter]
+	if call > 1 {
+		snapshotName = fmt.Sprintf("%s-%d", snapshotName, call)
+	}
+
+	owner := snapshotCall{counter: counter, call: call}
+	snapshotID := c.snapshotFilePath(snapshotName)
+	if c.singleFilePerTestFile {
+		snapshotID = fmt.Sprintf("%s (%s)", snapshotID, snapshotName)
+	}
+	if previousOwner, used := snapshotCalls.owners[snapshotID]; used && previousOwner != owner {
+		return "", fmt.Errorf("snapshot %s is used by both %s and %s: rename one of the tests to avoid the collision",
+			snapshotID, previousOwner, owner)
+	}
+	snapshotCalls.owners[snapshotID] = owner
+
+	return snapshotName, nil
+}
@@ -0,0 +1,334 @@
+package cupaloy
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// TestingM is a subset of *testing.M allowing it to be mocked in tests.
+type TestingM interface {
+	Run() int
+}
+
+// pruneEnvValue is the value of the UPDATE_SNAPSHOTS environment variable which causes obsolete
+// snapshots to be deleted by Run.
+const pruneEnvValue = "prune"
+
+// usedSnapshots records every store used during this test run, along with the name of every snapshot file
+// used in it, so that obsolete snapshot files can be detected afterwards. For files holding multiple snapshots
+// (see SingleFilePerTestFile) the names of the snapshots used are also recorded.
+// Stores are keyed by their (absolute) directory for the default Store and otherwise by the Store itself.
+var usedSnapshots = struct {
+	sync.Mutex
+	stores map[Store]*usedStore
+}{
+	stores: map[Store]*usedStore{},
+}
+
+// usedStore is a store in which snapshots were used. The extensions of the snapshot files written there are
+// recorded (so that other files aren't mistaken for snapshots) along with whether every Config using the store
+// asked for obsolete snapshots to be pruned.
+type usedStore struct {
+	store Store
+	// dir is the directory of the default Store (and empty for other stores)
+	dir        string
+	files      map[string]bool
+	sections   map[string]map[string]bool
+	extensions map[string]bool
+	prune      bool
+}
+
+// path returns the path used to refer to a file in the store (as in Config.storePath).
+func (u *usedStore) path(name string) string {
+	if u.dir == "" {
+		return name
+	}
+	return filepath.Join(u.dir, filepath.FromSlash(name))
+}
+
+// recordSnapshotUsed records that a snapshot was used.
+func (c *Config) recordSnapshotUsed(snapshotName string) {
+	if c.singleFilePerTestFile {
+		c.recordFileUsed(c.snapshotFileName(snapshotName), singleFileExtension, snapshotName)
+		return
+	}
+	c.recordFileUsed(c.snapshotFileName(snapshotName), c.fileExtension(), "")
+}
+
+// recordFileUsed records that a snapshot file in the configured store with the given extension (or a section
+// of one if section isn't empty) was used.
+func (c *Config) recordFileUsed(snapshotFile string, extension string, section string) {
+	store, dir := c.getStore(), ""
+	if _, ok := store.(dirStore); ok {
+		absolute, err := filepath.Abs(c.storePath(""))
+		if err != nil {
+			return
+		}
+		store, dir = dirStore{dir: absolute}, absolute
+	} else if reflect.ValueOf(store).Kind() != reflect.Ptr {
+		// there's no way to tell whether two Configs use the same store (and read-only stores such as
+		// those returned by NewFSStore can't be pruned anyway)
+		return
+	}
+
+	usedSnapshots.Lock()
+	defer usedSnapshots.Unlock()
+	used := usedSnapshots.stores[store]
+	if used == nil {
+		used = &usedStore{
+			store:      store,
+			dir:        dir,
+			files:      map[string]bool{},
+			sections:   map[string]map[string]bool{},
+			extensions: map[string]bool{},
+			prune:      true,
+		}
+		usedSnapshots.stores[store] = used
+	}
+	used.files[snapshotFile] = true
+	used.extensions[extension] = true
+	used.prune = used.prune && c.shouldPrune != nil && c.shouldPrune()
+
+	if section != "" {
+		if used.sections[snapshotFile] == nil {
+			used.sections[snapshotFile] = map[string]bool{}
+		}
+		used.sections[snapshotFile][section] = true
+	}
+}
+
+// obsoleteSnapshot is either a whole snapshot file or, if section is set, one snapshot within a file
+// holding multiple snapshots.
+type obsoleteSnapshot struct {
+	store Store
+	name  string
+	// path is the path of the file shown to the user: on the filesystem for the default Store
+	path    string
+	section string
+	// prune is true if the snapshot should be deleted
+	prune bool
+}
+
+func (o obsoleteSnapshot) String() string {
+	if o.section == "" {
+		return relativePath(o.path)
+	}
+	return fmt.Sprintf("%s (%s)", relativePath(o.path), o.section)
+}
+
+// Run runs the tests and then prints a summary of the snapshots taken (how many passed, were written, updated
+// or failed) and reports any obsolete snapshots: files in the snapshot directories (or other Stores) used
+// during the run which were not used by any test (e.g. because the test was renamed or deleted).
+// It is intended to be called from TestMain e.g.
+//  func TestMain(m *testing.M) {
+//    os.Exit(cupaloy.Run(m))
+//  }
+// If the UPDATE_SNAPSHOTS environment variable (or that configured using EnvVariableName) is set to "prune" then
+// (as well as snapshots being updated as usual) obsolete snapshots are deleted, unless in strict mode (e.g. in CI).
+// Obsolete snapshots are only reported if every test was run and passed: when using flags such as
+// -run or -short, or if any test failed, some snapshots will not have been used.
+// Only files with the extension of the snapshots written to a directory are considered to be snapshots and
+// nothing is deleted from directories which also contain other files (e.g. test fixtures). Note that tests
+// which are skipped before they take their snapshot will have their snapshots reported as obsolete.
+// A warning is printed for each pattern in the UPDATE_SNAPSHOTS environment variable which doesn't contain any
+// wildcards and didn't match any snapshot (e.g. UPDATE_SNAPSHOTS=y, which selects a snapshot named "y").
+// If the UPDATE_SNAPSHOTS environment variable is set to "migrate" then the snapshots which were migrated
+// to the current format are also reported.
+// If the CUPALOY_SUMMARY_JSON environment variable is set to the (absolute) path of a file then the summary
+// is also appended to that file as a line of JSON.
+// If the CUPALOY_REPORT_JUNIT environment variable is set to a directory then a JUnit XML report of every
+// snapshot taken is written there (see also CUPALOY_REPORT_JSON).
+func Run(m TestingM) int {
+	code := m.Run()
+	reportSummary(os.Stdout)
+	reportUnmatchedUpdatePatterns(os.Stdout)
+	if err := writeSummaryJSON(); err != nil {
+		fmt.Fprintf(os.Stderr, "cupaloy: unable to write snapshot summary: %s\n", err)
+	}
+	if err := writeJUnitReport(); err != nil {
+		fmt.Fprintf(os.Stderr, "cupaloy: unable to write JUnit report: %s\n", err)
+	}
+	reportMigratedSnapshots(os.Stdout)
+	if code != 0 || isPartialRun() {
+		return code
+	}
+
+	obsolete, err := findObsoleteSnapshots()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupaloy: unable to check for obsolete snapshots: %s\n", err)
+		return code
+	}
+
+	if err := reportObsoleteSnapshots(os.Stdout, obsolete); err != nil {
+		fmt.Fprintf(os.Stderr, "cupaloy: unable to prune obsolete snapshots: %s\n", err)
+		return 1
+	}
+	return code
+}
+
+// isPartialRun checks for go test flags that cause only some of the tests to be run.
+func isPartialRun() bool {
+	for _, name := range []string{"test.run", "test.skip", "test.list"} {
+		if f := flag.Lookup(name); f != nil && f.Value.String() != "" {
+			return true
+		}
+	}
+
+	// tests commonly skip themselves using testing.Short()
+	if f := flag.Lookup("test.short"); f != nil && f.Value.String() == "true" {
+		return true
+	}
+
+	return false
+}
+
+// findObsoleteSnapshots returns (sorted) all files in the used stores which were not themselves used, as well
+// as the unused snapshots within used files holding multiple snapshots.
+func findObsoleteSnapshots() ([]obsoleteSnapshot, error) {
+	usedSnapshots.Lock()
+	defer usedSnapshots.Unlock()
+
+	var obsolete []obsoleteSnapshot
+	for _, used := range usedSnapshots.stores {
+		files, err := used.store.List()
+		if err != nil {
+			return nil, err
+		}
+
+		var storeObsolete []obsoleteSnapshot
+		onlySnapshots := true
+		for _, name := range files {
+			if strings.HasSuffix(name, internal.PendingSuffix) || strings.HasSuffix(name, fullDiffSuffix) ||
+				strings.HasSuffix(name, imageDiffSuffix) {
+				// not snapshots themselves
+				continue
+			}
+			if !isSnapshotFile(name, used.extensions) {
+				onlySnapshots = false
+				continue
+			}
+			if !used.files[name] {
+				storeObsolete = append(storeObsolete, obsoleteSnapshot{store: used.store, name: name, path: used.path(name)})
+				continue
+			}
+
+			if usedSections, ok := used.sections[name]; ok {
+				sections, err := readSnapshotSections(used.store, name)
+				if err != nil {
+					return nil, err
+				}
+				for section := range sections {
+					if !usedSections[section] {
+						storeObsolete = append(storeObsolete, obsoleteSnapshot{store: used.store, name: name, path: used.path(name), section: section})
+					}
+				}
+			}
+		}
+
+		prune := used.prune && !strictMode()
+		if prune && !onlySnapshots && len(storeObsolete) > 0 {
+			fmt.Fprintf(os.Stdout, "cupaloy: not deleting obsolete snapshots in %s as it contains files which aren't snapshots\n", relativePath(used.path("")))
+			prune = false
+		}
+		for n := range storeObsolete {
+			storeObsolete[n].prune = prune
+		}
+		obsolete = append(obsolete, storeObsolete...)
+	}
+
+	sort.Slice(obsolete, func(i, j int) bool {
+		if obsolete[i].path != obsolete[j].path {
+			return obsolete[i].path < obsolete[j].path
+		}
+		return obsolete[i].section < obsolete[j].section
+	})
+	return obsolete, nil
+}
+
+func reportObsoleteSnapshots(w io.Writer, obsolete []obsoleteSnapshot) error {
+	var reported, pruned []obsoleteSnapshot
+	for _, o := range obsolete {
+		if o.prune {
+			pruned = append(pruned, o)
+		} else {
+			reported = append(reported, o)
+		}
+	}
+
+	if len(reported) > 0 {
+		fmt.Fprintf(w, "cupaloy: %d obsolete snapshot(s) found (set UPDATE_SNAPSHOTS=%s to delete them):\n", len(reported), pruneEnvValue)
+		for _, o := range reported {
+			fmt.Fprintf(w, "  %s\n", o)
+		}
+	}
+
+	if len(pruned) > 0 {
+		fmt.Fprintf(w, "cupaloy: deleting %d obsolete snapshot(s):\n", len(pruned))
+		for _, o := range pruned {
+			fmt.Fprintf(w, "  %s\n", o)
+			if err := pruneObsoleteSnapshot(o); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isSnapshotFile checks whether a file in a snapshot directory has the extension of any of the snapshots written
+// there. Hidden files (e.g. .gitkeep) are never snapshots.
+func isSnapshotFile(name string, extensions map[string]bool) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	for extension := range extensions {
+		if extension == "" && filepath.Ext(name) == "" || extension != "" && strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+func pruneObsoleteSnapshot(o obsoleteSnapshot) error {
+	if o.section == "" {
+		return o.store.Delete(o.name)
+	}
+
+	unlock, err := lockStoreFile(o.store, o.name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sections, err := readSnapshotSections(o.store, o.name)
+	if err != nil {
+		return err
+	}
+	delete(sections, o.section)
+	if len(sections) == 0 {
+		return o.store.Delete(o.name)
+	}
+	return o.store.Write(o.name, sections.encode())
+}
+
+// relativePath makes paths relative to the working directory (i.e. the package being tested) for display.
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	relative, err := filepath.Rel(wd, path)
+	if err != nil {
+		return path
+	}
+	return relative
+}
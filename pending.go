@@ -0,0 +1,92 @@
+package cupaloy
+
+import (
+	"errors"
+	"os"
+	"reflect"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// pendingEnvValue is the value of the UPDATE_SNAPSHOTS environment variable which causes
+// mismatching snapshots to be written to pending files for review rather than being updated.
+const pendingEnvValue = "pending"
+
+func (c *Config) pendingSnapshotFileName(snapshotName string) string {
+	return c.snapshotFileName(snapshotName) + internal.PendingSuffix
+}
+
+// writePendingSnapshot writes the new value of a snapshot alongside the existing snapshot so that
+// it can be reviewed (and accepted or rejected) using the cupaloy command.
+// The path of the pending file is returned.
+func (c *Config) writePendingSnapshot(snapshotName string, snapshot string) (string, error) {
+	pendingFile := c.pendingSnapshotFileName(snapshotName)
+	var err error
+	if c.singleFilePerTestFile {
+		err = c.writePendingSection(pendingFile, snapshotName, c.encodeSnapshot(snapshot))
+	} else {
+		err = c.getStore().Write(pendingFile, []byte(c.encodeSnapshot(snapshot)))
+	}
+	return c.storePath(pendingFile), err
+}
+
+// writePendingSection adds a snapshot to the pending file of a single snapshot file. The pending file
+// is a copy of the whole snapshot file with every pending snapshot applied so that accepting it simply
+// replaces the snapshot file.
+func (c *Config) writePendingSection(pendingFile string, snapshotName string, snapshot string) error {
+	store := c.getStore()
+	sections, err := readSnapshotSections(store, c.snapshotFileName(snapshotName))
+	if err != nil {
+		return err
+	}
+
+	pending, err := readSnapshotSections(store, pendingFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for name, pendingSnapshot := range pending {
+		sections[name] = pendingSnapshot
+	}
+
+	sections[snapshotName] = snapshot
+	return store.Write(pendingFile, sections.encode())
+}
+
+// removePendingSnapshot removes any pending snapshot left over from a previous run which is no
+// longer needed because the snapshot now matches.
+func (c *Config) removePendingSnapshot(snapshotName string) error {
+	if c.singleFilePerTestFile {
+		return c.removePendingSection(snapshotName)
+	}
+
+	err := c.getStore().Delete(c.pendingSnapshotFileName(snapshotName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// removePendingSection reverts a snapshot in the pending file of a single snapshot file, removing the
+// pending file entirely once it no longer contains any pending snapshots.
+func (c *Config) removePendingSection(snapshotName string) error {
+	store := c.getStore()
+	pendingFile := c.pendingSnapshotFileName(snapshotName)
+	pending, err := readSnapshotSections(store, pendingFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	sections, err := readSnapshotSections(store, c.snapshotFileName(snapshotName))
+	if err != nil {
+		return err
+	}
+
+	pending[snapshotName] = sections[snapshotName]
+	if reflect.DeepEqual(pending, sections) {
+		return store.Delete(pendingFile)
+	}
+	return store.Write(pendingFile, pending.encode())
+}
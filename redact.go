@@ -0,0 +1,554 @@
+package cupaloy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// redactionPath is a parsed path passed to the Redact Configurator e.g.
+//  Resp.Items[*].CreatedAt
+// is parsed into the root "Resp" followed by the segments "Items", "*" and "CreatedAt".
+type redactionPath struct {
+	// root is the optional leading segment naming the snapshotted value: either "$" or the
+	// name of its type. If it matches neither it is treated as the first segment instead.
+	root     string
+	segments []string
+}
+
+func parseRedactionPath(path string) (redactionPath, error) {
+	var segments []string
+	current := &strings.Builder{}
+	inBrackets := false
+
+	flush := func() {
+		segments = append(segments, current.String())
+		current.Reset()
+	}
+
+	for i, r := range path {
+		switch {
+		case r == '[' && !inBrackets:
+			if i > 0 && path[i-1] != ']' {
+				flush()
+			}
+			inBrackets = true
+		case r == ']' && inBrackets:
+			flush()
+			inBrackets = false
+		case r == '.' && !inBrackets:
+			if i > 0 && path[i-1] != ']' {
+				flush()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inBrackets {
+		return redactionPath{}, fmt.Errorf("invalid redaction path %q: unclosed [", path)
+	}
+	if current.Len() > 0 || len(segments) == 0 {
+		flush()
+	}
+
+	for _, segment := range segments {
+		if segment == "" {
+			return redactionPath{}, fmt.Errorf("invalid redaction path %q: empty segment", path)
+		}
+	}
+
+	return redactionPath{root: segments[0], segments: segments[1:]}, nil
+}
+
+// redactor replaces the values found at a set of paths with a placeholder.
+type redactor struct {
+	paths []redactionPath
+}
+
+// withPaths returns a new redactor which also redacts the given paths.
+// It panics if any of the paths are invalid.
+func (r *redactor) withPaths(paths ...string) *redactor {
+	combined := &redactor{}
+	if r != nil {
+		combined.paths = append(combined.paths, r.paths...)
+	}
+
+	for _, path := range paths {
+		parsed, err := parseRedactionPath(path)
+		if err != nil {
+			panic(err)
+		}
+		combined.paths = append(combined.paths, parsed)
+	}
+	return combined
+}
+
+// redact returns a copy of i with all matching paths (as well as any fields with a cupaloy struct tag)
+// redacted. Values which contain nothing to redact are returned unchanged.
+// It is safe to call on a nil redactor, in which case only struct tags are applied.
+// Struct types which need to be rebuilt only keep their struct tags if keepTags is set: serializers
+// such as JSONSerializer need them but for spew they are just noise.
+// If keepStringers is set, values with a String or Error method are left unchanged as it is the output of that
+// method which is snapshotted (and rebuilding the value's type would lose the method).
+// The names of any rebuilt struct types are returned so that they can be restored in spew snapshots.
+func (r *redactor) redact(i []interface{}, keepTags bool, keepStringers bool) ([]interface{}, rebuiltTypes) {
+	redacted := make([]interface{}, len(i))
+	types := rebuiltTypes{}
+	for n, v := range i {
+		redacted[n] = v
+		if v == nil {
+			continue
+		}
+
+		value := reflect.ValueOf(v)
+		var remaining [][]string
+		if r != nil {
+			for _, path := range r.paths {
+				remaining = append(remaining, path.resolveRoot(value.Type()))
+			}
+		}
+
+		w := &redactionWalker{visiting: map[visit]bool{}, types: types, keepTags: keepTags, keepStringers: keepStringers}
+		if newValue, changed := w.redactValue(value, remaining); changed {
+			redacted[n] = newValue.Interface()
+		}
+	}
+	return redacted, types
+}
+
+// resolveRoot returns the segments of the path which remain to be matched against a value of type t.
+func (p redactionPath) resolveRoot(t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if p.root == "$" || p.root == t.Name() {
+		return p.segments
+	}
+	return append([]string{p.root}, p.segments...)
+}
+
+// redactedPlaceholder is the value which replaces redacted values in snapshots.
+func redactedPlaceholder(v reflect.Value) string {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return fmt.Sprintf("[REDACTED %s]", v.Type())
+}
+
+// visit identifies a pointer, map or slice which is currently being walked so that cycles can be detected.
+type visit struct {
+	kind reflect.Kind
+	ptr  uintptr
+}
+
+type redactionWalker struct {
+	visiting      map[visit]bool
+	types         rebuiltTypes
+	keepTags      bool
+	keepStringers bool
+}
+
+var (
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// hasStringerMethod reports whether a value of type t is snapshotted using its String or Error method.
+// As with spew, methods with pointer receivers are also used.
+func hasStringerMethod(t reflect.Type) bool {
+	if t.Kind() == reflect.Interface {
+		// depends on the dynamic value
+		return false
+	}
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	return t.Implements(stringerType) || t.Implements(errorType)
+}
+
+// redactValue recursively redacts v. It returns the (possibly re-typed) redacted value and
+// whether anything was changed. The remaining paths are relative to v.
+func (w *redactionWalker) redactValue(v reflect.Value, paths [][]string) (reflect.Value, bool) {
+	if len(paths) == 0 && !mayHaveTaggedFields(v.Type()) {
+		return v, false
+	}
+
+	for _, path := range paths {
+		if len(path) == 0 {
+			return placeholderFor(v), true
+		}
+	}
+
+	if w.keepStringers && hasStringerMethod(v.Type()) {
+		return v, false
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return v, false
+		}
+		key := visit{v.Kind(), v.Pointer()}
+		if w.visiting[key] {
+			// cyclic data structure: spew and friends will deal with this themselves
+			return v, false
+		}
+		w.visiting[key] = true
+		defer delete(w.visiting, key)
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		elem, changed := w.redactValue(v.Elem(), paths)
+		if !changed {
+			return v, false
+		}
+		if v.Kind() == reflect.Interface {
+			return elem, true
+		}
+		ptr := reflect.New(elem.Type())
+		ptr.Elem().Set(elem)
+		return ptr, true
+
+	case reflect.Struct:
+		return w.redactStruct(v, paths)
+
+	case reflect.Slice, reflect.Array:
+		return w.redactElements(v, paths)
+
+	case reflect.Map:
+		return w.redactMap(v, paths)
+	}
+
+	return v, false
+}
+
+// placeholderFor returns the placeholder for v, keeping the type of v if it is able to hold a string.
+func placeholderFor(v reflect.Value) reflect.Value {
+	placeholder := reflect.ValueOf(redactedPlaceholder(v))
+	if v.Kind() == reflect.String {
+		return placeholder.Convert(v.Type())
+	}
+	return placeholder
+}
+
+// matchingPaths returns the remainder of each path whose next segment matches any of the given names.
+func matchingPaths(paths [][]string, names ...string) [][]string {
+	var matching [][]string
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		for _, name := range names {
+			if path[0] == "*" || (name != "" && path[0] == name) {
+				matching = append(matching, path[1:])
+				break
+			}
+		}
+	}
+	return matching
+}
+
+func (w *redactionWalker) redactStruct(v reflect.Value, paths [][]string) (reflect.Value, bool) {
+	v = addressable(v)
+	t := v.Type()
+
+	var structFields []reflect.StructField
+	var fields []reflect.Value
+	anyChanged := false
+	sameType := true
+	for n := 0; n < t.NumField(); n++ {
+		field := t.Field(n)
+		value := accessible(v.Field(n))
+
+		tag := parseCupaloyTag(field.Tag.Get("cupaloy"))
+		if tag.skip {
+			anyChanged, sameType = true, false
+			continue
+		}
+
+		names := []string{field.Name, tagName(field.Tag.Get("json")), tagName(field.Tag.Get("yaml"))}
+		fieldPaths := matchingPaths(paths, names...)
+		if tag.redact {
+			fieldPaths = append(fieldPaths, []string{})
+		}
+
+		newValue, changed := w.redactValue(value, fieldPaths)
+		if changed {
+			anyChanged = true
+			value = newValue
+			if newValue.Type() != field.Type && !isInterfaceHolding(field.Type, newValue) {
+				sameType = false
+			}
+		}
+		if tag.name != "" && tag.name != field.Name {
+			anyChanged, sameType = true, false
+			field = renameField(field, tag.name, t.PkgPath())
+		}
+
+		structFields = append(structFields, field)
+		fields = append(fields, value)
+	}
+	if !anyChanged {
+		return v, false
+	}
+
+	if !sameType {
+		return w.rebuildStruct(t, structFields, fields), true
+	}
+
+	redacted := reflect.New(t).Elem()
+	for n, field := range fields {
+		accessible(redacted.Field(n)).Set(field)
+	}
+	return redacted, true
+}
+
+// rebuildStruct returns a value of a new struct type (built with reflect.StructOf) holding the given fields of
+// a struct of type t. The new type is recorded so that spew snapshots can show the name of the original type.
+func (w *redactionWalker) rebuildStruct(t reflect.Type, structFields []reflect.StructField, values []reflect.Value) reflect.Value {
+	redacted, ok := w.buildStruct(structFields, values, true)
+	if !ok {
+		// StructOf doesn't support every embedded type (e.g. ones with methods) so fall back to named fields
+		redacted, _ = w.buildStruct(structFields, values, false)
+	}
+	w.types.record(redacted.Type(), t)
+	return redacted
+}
+
+// buildStruct builds a struct holding the given fields. Embedded fields stay embedded (so that encoding/json
+// still promotes their fields) where StructOf allows it and embed is set. Otherwise they become named fields
+// and, for serializers which use the struct tags, their exported fields are promoted explicitly.
+func (w *redactionWalker) buildStruct(structFields []reflect.StructField, values []reflect.Value, embed bool) (redacted reflect.Value, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	var fields []reflect.StructField
+	var fieldValues []reflect.Value
+	var promoted []reflect.Value
+	names, jsonNames := map[string]bool{}, map[string]bool{}
+	for n, field := range structFields {
+		field.Type = values[n].Type()
+		field.Index, field.Offset = nil, 0
+		field.Tag = w.rebuiltTag(field.Tag)
+		if field.Anonymous && !(embed && field.PkgPath == "" && embeddable(field.Type)) {
+			field.Anonymous = false
+			if w.keepTags {
+				// JSON gets the promoted fields instead (YAML only inlines embedded structs when asked to)
+				promoted = append(promoted, values[n])
+				field.Tag = withTag(field.Tag, "json", "-")
+			}
+		}
+
+		names[field.Name] = true
+		jsonNames[jsonName(field)] = true
+		fields = append(fields, field)
+		fieldValues = append(fieldValues, values[n])
+	}
+
+	for _, embedded := range promoted {
+		for embedded.Kind() == reflect.Ptr && !embedded.IsNil() {
+			embedded = embedded.Elem()
+		}
+		if embedded.Kind() != reflect.Struct {
+			continue
+		}
+		embedded = addressable(embedded)
+		for n := 0; n < embedded.NumField(); n++ {
+			field := embedded.Type().Field(n)
+			if field.PkgPath != "" || field.Anonymous || names[field.Name] || jsonName(field) == "" || jsonNames[jsonName(field)] {
+				// outer fields take precedence, as they do in encoding/json
+				continue
+			}
+			names[field.Name], jsonNames[jsonName(field)] = true, true
+
+			field.Index, field.Offset = nil, 0
+			field.Tag = withTag(w.rebuiltTag(field.Tag), "yaml", "-")
+			fields = append(fields, field)
+			fieldValues = append(fieldValues, accessible(embedded.Field(n)))
+		}
+	}
+
+	redacted = reflect.New(reflect.StructOf(fields)).Elem()
+	for n, value := range fieldValues {
+		accessible(redacted.Field(n)).Set(value)
+	}
+	return redacted, true
+}
+
+// embeddable reports whether reflect.StructOf supports embedding a field of type t:
+// it can't promote methods so only embeds struct types without any.
+func embeddable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t.NumMethod() == 0 && reflect.PtrTo(t).NumMethod() == 0
+}
+
+// jsonName returns the name encoding/json uses for a field (or "" if it is skipped).
+func jsonName(field reflect.StructField) string {
+	tag, ok := field.Tag.Lookup("json")
+	if !ok || (tagName(tag) == "" && tag != "-") {
+		return field.Name
+	}
+	return tagName(tag)
+}
+
+// withTag returns tag with the value of key replaced.
+func withTag(tag reflect.StructTag, key, value string) reflect.StructTag {
+	kept := []string{fmt.Sprintf("%s:%q", key, value)}
+	for _, other := range []string{"json", "yaml"} {
+		if existing, ok := tag.Lookup(other); ok && other != key {
+			kept = append(kept, fmt.Sprintf("%s:%q", other, existing))
+		}
+	}
+	return reflect.StructTag(strings.Join(kept, " "))
+}
+
+// rebuiltTypes maps the names of struct types built while redacting to the names of the types they replace.
+type rebuiltTypes map[string]string
+
+func (r rebuiltTypes) record(rebuilt, original reflect.Type) {
+	if rebuilt.String() != original.String() {
+		r[rebuilt.String()] = original.String()
+	}
+}
+
+// restore replaces the names of rebuilt types in a spew snapshot with the names of the original types.
+func (r rebuiltTypes) restore(snapshot string) string {
+	rebuilt := make([]string, 0, len(r))
+	for name := range r {
+		rebuilt = append(rebuilt, name)
+	}
+	// the names of outer types contain those of their fields' types
+	sort.Slice(rebuilt, func(i, j int) bool { return len(rebuilt[i]) > len(rebuilt[j]) })
+	for _, name := range rebuilt {
+		snapshot = strings.ReplaceAll(snapshot, name, r[name])
+	}
+	return snapshot
+}
+
+// rebuiltTag returns the struct tag to use for a field of a rebuilt struct type.
+func (w *redactionWalker) rebuiltTag(tag reflect.StructTag) reflect.StructTag {
+	if !w.keepTags {
+		return ""
+	}
+
+	// the cupaloy tag has already been applied
+	var kept []string
+	for _, key := range []string{"json", "yaml"} {
+		if value, ok := tag.Lookup(key); ok {
+			kept = append(kept, fmt.Sprintf("%s:%q", key, value))
+		}
+	}
+	return reflect.StructTag(strings.Join(kept, " "))
+}
+
+func (w *redactionWalker) redactElements(v reflect.Value, paths [][]string) (reflect.Value, bool) {
+	elems := make([]reflect.Value, v.Len())
+	anyChanged := false
+	for n := range elems {
+		var changed bool
+		elems[n], changed = w.redactValue(v.Index(n), matchingPaths(paths, fmt.Sprint(n)))
+		anyChanged = anyChanged || changed
+	}
+	if !anyChanged {
+		return v, false
+	}
+
+	elemType := commonType(v.Type().Elem(), elems)
+	var redacted reflect.Value
+	if v.Kind() == reflect.Array {
+		redacted = reflect.New(reflect.ArrayOf(v.Len(), elemType)).Elem()
+	} else {
+		redacted = reflect.MakeSlice(reflect.SliceOf(elemType), v.Len(), v.Len())
+	}
+	for n, elem := range elems {
+		redacted.Index(n).Set(elem)
+	}
+	return redacted, true
+}
+
+func (w *redactionWalker) redactMap(v reflect.Value, paths [][]string) (reflect.Value, bool) {
+	keys := v.MapKeys()
+	elems := make([]reflect.Value, len(keys))
+	anyChanged := false
+	for n, key := range keys {
+		var changed bool
+		elems[n], changed = w.redactValue(v.MapIndex(key), matchingPaths(paths, fmt.Sprint(key.Interface())))
+		anyChanged = anyChanged || changed
+	}
+	if !anyChanged {
+		return v, false
+	}
+
+	redacted := reflect.MakeMapWithSize(reflect.MapOf(v.Type().Key(), commonType(v.Type().Elem(), elems)), len(keys))
+	for n, key := range keys {
+		redacted.SetMapIndex(key, elems[n])
+	}
+	return redacted, true
+}
+
+// commonType returns the type which can hold all of the given values: the original element
+// type if possible, otherwise the type shared by all values, otherwise interface{}.
+func commonType(original reflect.Type, values []reflect.Value) reflect.Type {
+	fitsOriginal, shared := true, true
+	for _, value := range values {
+		if value.Type() != original && !isInterfaceHolding(original, value) {
+			fitsOriginal = false
+		}
+		if value.Type() != values[0].Type() {
+			shared = false
+		}
+	}
+
+	switch {
+	case fitsOriginal:
+		return original
+	case shared:
+		return values[0].Type()
+	default:
+		return reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+}
+
+func isInterfaceHolding(t reflect.Type, v reflect.Value) bool {
+	return t.Kind() == reflect.Interface && v.Type().Implements(t)
+}
+
+// tagName returns the name part of a struct tag such as `json:"name,omitempty"`.
+func tagName(tag string) string {
+	if tag == "-" {
+		return ""
+	}
+	return strings.Split(tag, ",")[0]
+}
+
+// addressable returns an addressable copy of v if v is not already addressable.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	return copied
+}
+
+// accessible allows the value of an (addressable) unexported struct field to be read and
+// written: snapshots include unexported fields so these need to be copied when redacting.
+func accessible(v reflect.Value) reflect.Value {
+	if v.CanSet() {
+		return v
+	}
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+}
@@ -0,0 +1,183 @@
+package cupaloy
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// Environment variables which configure where the outcome of every snapshot is reported:
+// reportJSONEnvVariable is the path of a file to which a line of JSON is appended for each snapshot and
+// reportJUnitEnvVariable is a directory in which Run writes a JUnit XML report for each package.
+const (
+	reportJSONEnvVariable  = "CUPALOY_REPORT_JSON"
+	reportJUnitEnvVariable = "CUPALOY_REPORT_JUNIT"
+)
+
+// snapshotRecord is the outcome of a single snapshot as reported to CI systems.
+type snapshotRecord struct {
+	Package     string `json:"package"`
+	Test        string `json:"test"`
+	Name        string `json:"name"`
+	File        string `json:"file"`
+	Outcome     string `json:"outcome"`
+	Diff        string `json:"diff,omitempty"`
+	PendingFile string `json:"pendingFile,omitempty"`
+	DiffFile    string `json:"diffFile,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// reportedSnapshots holds the records of every snapshot taken during this test run so that Run can write
+// the JUnit report once all tests have finished.
+var reportedSnapshots = struct {
+	sync.Mutex
+	records []snapshotRecord
+}{}
+
+// reportSnapshot reports the outcome of a snapshot stored in snapshotFile if any report has been configured.
+func (c *Config) reportSnapshot(snapshotName string, snapshotFile string, test string, outcome string, err error) {
+	jsonFile, junitDir := os.Getenv(reportJSONEnvVariable), os.Getenv(reportJUnitEnvVariable)
+	if jsonFile == "" && junitDir == "" {
+		return
+	}
+
+	record := snapshotRecord{
+		Package: functionPackage(test),
+		Test:    filepath.Base(test),
+		Name:    snapshotName,
+		File:    snapshotFile,
+		Outcome: outcome,
+	}
+	var mismatch internal.ErrSnapshotMismatch
+	if errors.As(err, &mismatch) {
+		record.Diff, record.PendingFile, record.DiffFile = mismatch.Diff, mismatch.PendingFile, mismatch.DiffFile
+	}
+	if outcome == outcomeError {
+		record.Error = err.Error()
+	}
+
+	reportedSnapshots.Lock()
+	defer reportedSnapshots.Unlock()
+	if junitDir != "" {
+		reportedSnapshots.records = append(reportedSnapshots.records, record)
+	}
+	if jsonFile != "" {
+		if err := appendJSONLine(jsonFile, record); err != nil {
+			fmt.Fprintf(os.Stderr, "cupaloy: unable to report snapshot %s: %s\n", snapshotName, err)
+		}
+	}
+}
+
+// appendJSONLine appends v to a file of newline-delimited JSON. Each line is appended using a single
+// write so that lines written by packages tested in parallel don't interleave.
+func appendJSONLine(path string, v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.FileMode(0644))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(encoded, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// The subset of the JUnit XML format written by writeJUnitReport. The details of each snapshot are
+// stored as properties of its test case.
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName  string          `xml:"classname,attr"`
+	Name       string          `xml:"name,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Failure    *junitFailure   `xml:"failure,omitempty"`
+	Error      *junitFailure   `xml:"error,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// writeJUnitReport writes the snapshots taken during this test run as a JUnit XML test suite to the
+// directory named by the CUPALOY_REPORT_JUNIT environment variable (if set). As go test runs each package's
+// tests separately, each package is written to its own file named after the package's import path.
+func writeJUnitReport() error {
+	dir := os.Getenv(reportJUnitEnvVariable)
+	if dir == "" {
+		return nil
+	}
+
+	reportedSnapshots.Lock()
+	defer reportedSnapshots.Unlock()
+	if len(reportedSnapshots.records) == 0 {
+		return nil
+	}
+
+	suite := junitTestSuite{Name: reportedSnapshots.records[0].Package}
+	for _, record := range reportedSnapshots.records {
+		testCase := junitTestCase{
+			ClassName: record.Test,
+			Name:      record.Name,
+		}
+		for _, property := range []junitProperty{
+			{"cupaloy.file", record.File},
+			{"cupaloy.outcome", record.Outcome},
+			{"cupaloy.pendingFile", record.PendingFile},
+			{"cupaloy.diffFile", record.DiffFile},
+		} {
+			if property.Value != "" {
+				testCase.Properties = append(testCase.Properties, property)
+			}
+		}
+
+		switch record.Outcome {
+		case outcomeFailed:
+			suite.Failures++
+			testCase.Failure = &junitFailure{Message: fmt.Sprintf("snapshot %s does not match", record.Name), Contents: record.Diff}
+		case outcomeMissing:
+			suite.Failures++
+			testCase.Failure = &junitFailure{Message: fmt.Sprintf("snapshot %s does not exist", record.Name)}
+		case outcomeError:
+			suite.Errors++
+			testCase.Error = &junitFailure{Message: record.Error}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Tests = len(suite.TestCases)
+
+	encoded, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(suite.Name) + ".xml"
+	return ioutil.WriteFile(filepath.Join(dir, name), append([]byte(xml.Header), encoded...), os.FileMode(0644))
+}
@@ -0,0 +1,60 @@
+package cupaloy
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// scrubber replaces all matches of a pattern in a snapshot (after serialization).
+type scrubber struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+var (
+	rfc3339Pattern       = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[Tt]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})`)
+	uuidPattern          = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	localhostPortPattern = regexp.MustCompile(`(\blocalhost|\b127\.0\.0\.1|\[::1\]):\d+\b`)
+)
+
+// ScrubRFC3339Times replaces RFC3339 timestamps (e.g. 2006-01-02T15:04:05Z07:00) in snapshots with "[TIME]".
+func ScrubRFC3339Times() Configurator {
+	return Scrub(rfc3339Pattern, "[TIME]")
+}
+
+// ScrubUUIDs replaces UUIDs (e.g. 8d5bd1b4-1fbb-4c0e-a2a3-6b6d7d7e8e5a) in snapshots with "[UUID]".
+func ScrubUUIDs() Configurator {
+	return Scrub(uuidPattern, "[UUID]")
+}
+
+// ScrubTempPaths replaces paths inside /tmp (or the directory returned by os.TempDir) in snapshots
+// with "[TEMP]/..." e.g. "/tmp/TestFoo123/file.txt" becomes "[TEMP]/file.txt".
+// The first directory inside the temporary directory is assumed to have been randomly generated
+// (e.g. by ioutil.TempDir or t.TempDir) and so is also replaced. Only paths which start with the temporary
+// directory (at the start of the snapshot or after whitespace or a quote) are replaced so that e.g.
+// "/var/tmp/file.txt" and "/home/user/repo/tmp/file.txt" are left alone.
+func ScrubTempPaths() Configurator {
+	tempDirs := []string{regexp.QuoteMeta("/tmp")}
+	if tempDir := filepath.ToSlash(os.TempDir()); tempDir != "/tmp" {
+		tempDirs = append(tempDirs, regexp.QuoteMeta(strings.TrimSuffix(tempDir, "/")))
+	}
+
+	pattern := regexp.MustCompile(`(^|[\s"'` + "`" + `])(` + strings.Join(tempDirs, "|") + `)/[^/\s"'` + "`" + `]+`)
+	return Scrub(pattern, "${1}[TEMP]")
+}
+
+// ScrubLocalhostPorts replaces the port numbers of localhost addresses (e.g. 127.0.0.1:54321 or
+// [::1]:54321) in snapshots with "[PORT]".
+func ScrubLocalhostPorts() Configurator {
+	return Scrub(localhostPortPattern, "${1}:[PORT]")
+}
+
+// scrub applies all the configured scrubbers to the snapshot in the order they were configured.
+func (c *Config) scrub(snapshot string) string {
+	for _, s := range c.scrubbers {
+		snapshot = s.pattern.ReplaceAllString(snapshot, s.replacement)
+	}
+	return snapshot
+}
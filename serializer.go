@@ -0,0 +1,119 @@
+package cupaloy
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// Serializer converts the values passed to Snapshot (and friends) into the text which is
+// stored in, and compared against, the snapshot file.
+// A custom Serializer can be configured using the WithSerializer Configurator.
+type Serializer interface {
+	Serialize(i ...interface{}) (string, error)
+}
+
+// fileExtensioner can be implemented by a Serializer to choose the extension of the snapshot
+// files it writes (unless overridden by the SnapshotFileExtension Configurator).
+type fileExtensioner interface {
+	FileExtension() string
+}
+
+// snapshotDiffer can be implemented by a Serializer to choose how mismatches between its snapshots
+// are displayed (unless overridden by the DiffSnapshots Configurator). contextLines is the number of
+// unchanged lines to show around each change (see DiffContextLines).
+type snapshotDiffer interface {
+	Diff(previous, current string, contextLines int) string
+}
+
+// SpewSerializer is the default Serializer.
+// Strings and byte slices are written out raw, all other values are dumped using go-spew.
+// Byte slices which aren't valid UTF-8 (i.e. binary data) are written as a hex dump instead.
+type SpewSerializer struct {
+	// UseStringerMethods controls whether String() or Error() methods are invoked
+	// when available rather than dumping the object.
+	UseStringerMethods bool
+	// HexDumpBytes controls whether all byte slices are written as a hex dump, rather than
+	// only those which aren't valid UTF-8.
+	HexDumpBytes bool
+}
+
+// Serialize implements Serializer.
+func (s SpewSerializer) Serialize(i ...interface{}) (string, error) {
+	return s.serialize(s.shouldHexDump, i...), nil
+}
+
+func (s SpewSerializer) shouldHexDump(b []byte) bool {
+	return len(b) > 0 && (s.HexDumpBytes || !utf8.Valid(b))
+}
+
+func (s SpewSerializer) serialize(shouldHexDump func([]byte) bool, i ...interface{}) string {
+	snapshot := &bytes.Buffer{}
+	for _, v := range i {
+		switch vt := v.(type) {
+		case string:
+			snapshot.WriteString(vt)
+			snapshot.WriteString("\n")
+		case []byte:
+			if shouldHexDump(vt) {
+				writeHexDump(snapshot, vt)
+				continue
+			}
+			snapshot.Write(vt)
+			snapshot.WriteString("\n")
+		default:
+			s.spewConfig().Fdump(snapshot, v)
+		}
+	}
+
+	return snapshot.String()
+}
+
+// writeHexDump writes binary data in the same format as xxd: the offset, 16 bytes in groups of two and
+// then the same bytes as ASCII (with non-printable characters replaced by "."). Every line holds the
+// same offsets so a line based diff of two hex dumps aligns the bytes being compared e.g.
+//  00000000: 4865 6c6c 6f00 0102 0304 0506 0708 090a  Hello...........
+//  00000010: ff                                       .
+func writeHexDump(w *bytes.Buffer, data []byte) {
+	const lineLength = 16
+	for offset := 0; offset < len(data); offset += lineLength {
+		line := data[offset:]
+		if len(line) > lineLength {
+			line = line[:lineLength]
+		}
+
+		fmt.Fprintf(w, "%08x:", offset)
+		for n := 0; n < lineLength; n++ {
+			if n%2 == 0 {
+				w.WriteString(" ")
+			}
+			if n < len(line) {
+				fmt.Fprintf(w, "%02x", line[n])
+			} else {
+				w.WriteString("  ")
+			}
+		}
+
+		w.WriteString("  ")
+		for _, b := range line {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+			w.WriteByte(b)
+		}
+		w.WriteString("\n")
+	}
+}
+
+func (s SpewSerializer) spewConfig() *spew.ConfigState {
+	return &spew.ConfigState{
+		Indent:                  "  ",
+		SortKeys:                true, // maps should be spewed in a deterministic order
+		DisablePointerAddresses: true, // don't spew the addresses of pointers
+		DisableCapacities:       true, // don't spew capacities of collections
+		SpewKeys:                true, // if unable to sort map keys then spew keys to strings and sort those
+		DisableMethods:          !s.UseStringerMethods,
+	}
+}
@@ -0,0 +1,95 @@
+package cupaloy
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// JSONSerializer is a Serializer which stores snapshots as indented JSON using encoding/json.
+// Object keys are sorted throughout (including struct fields and the keys of nested json.RawMessage
+// values) and strings and byte slices which contain JSON are pretty-printed rather than written out raw.
+// Snapshots taken with JSONSerializer are stored with a .json file extension unless
+// SnapshotFileExtension is also configured.
+type JSONSerializer struct {
+	// Indent is the string used to indent each level of nesting. Defaults to two spaces.
+	Indent string
+}
+
+// Serialize implements Serializer.
+func (s JSONSerializer) Serialize(i ...interface{}) (string, error) {
+	snapshot := &bytes.Buffer{}
+	for _, v := range i {
+		v, err := s.normalise(v)
+		if err != nil {
+			return "", err
+		}
+
+		encoder := json.NewEncoder(snapshot)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", s.indent())
+		if err := encoder.Encode(v); err != nil {
+			return "", err
+		}
+	}
+
+	return snapshot.String(), nil
+}
+
+// FileExtension is the extension used for snapshot files written by this Serializer.
+func (s JSONSerializer) FileExtension() string {
+	return ".json"
+}
+
+func (s JSONSerializer) indent() string {
+	if s.Indent == "" {
+		return "  "
+	}
+	return s.Indent
+}
+
+// normalise converts values to the generic JSON values (maps, slices, strings, json.Number etc.) they
+// encode as so that, when re-encoded, they have consistent indentation and sorted object keys
+// throughout (including within nested json.RawMessage values).
+func (s JSONSerializer) normalise(v interface{}) (interface{}, error) {
+	switch vt := v.(type) {
+	case string:
+		if looksLikeJSON([]byte(vt)) {
+			return decodeJSON([]byte(vt))
+		}
+		return vt, nil
+	case []byte:
+		if looksLikeJSON(vt) {
+			return decodeJSON(vt)
+		}
+		if utf8.Valid(vt) {
+			// encoding/json would otherwise base64 encode the bytes
+			return string(vt), nil
+		}
+	}
+
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(encoded)
+}
+
+func looksLikeJSON(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || (b[0] != '{' && b[0] != '[') {
+		return false
+	}
+	return json.Valid(b)
+}
+
+func decodeJSON(b []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber() // avoid losing precision by decoding numbers as float64
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,356 @@
+package cupaloy
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// StructuredSerializer is a Serializer which stores snapshots as JSON mirroring the structure of the Go
+// values: struct fields (including unexported fields) are named as in Go and kept in declaration order,
+// and each value is stored under its type e.g.
+//  {
+//    "api.Resp": {
+//      "Items": [...]
+//    }
+//  }
+// Unlike other formats, snapshots can be decoded again so mismatches are reported using StructuralDiff
+// (unless DiffSnapshots or DiffSnapshotsWithContext is also configured). Values implementing json.Marshaler or encoding.TextMarshaler
+// (e.g. time.Time) are stored using those methods.
+// Snapshots taken with StructuredSerializer are stored with a .json file extension unless
+// SnapshotFileExtension is also configured.
+type StructuredSerializer struct {
+	// Indent is the string used to indent each level of nesting. Defaults to two spaces.
+	Indent string
+}
+
+// Serialize implements Serializer.
+func (s StructuredSerializer) Serialize(i ...interface{}) (string, error) {
+	snapshot := &bytes.Buffer{}
+	for _, v := range i {
+		value := reflect.ValueOf(v)
+		typeName := "nil"
+		if value.IsValid() {
+			typeName = value.Type().String()
+		}
+
+		node, err := structuredNode(value, map[visit]bool{})
+		if err != nil {
+			return "", err
+		}
+
+		root := &orderedObject{keys: []string{typeName}, values: []interface{}{node}}
+		if err := writeStructured(snapshot, root, s.indent(), ""); err != nil {
+			return "", err
+		}
+		snapshot.WriteString("\n")
+	}
+
+	return snapshot.String(), nil
+}
+
+// FileExtension is the extension used for snapshot files written by this Serializer.
+func (s StructuredSerializer) FileExtension() string {
+	return ".json"
+}
+
+// Diff is the default differ for snapshots taken with this Serializer.
+func (s StructuredSerializer) Diff(previous, current string, contextLines int) string {
+	return StructuralDiff(previous, current, contextLines)
+}
+
+func (s StructuredSerializer) indent() string {
+	if s.Indent == "" {
+		return "  "
+	}
+	return s.Indent
+}
+
+// orderedObject is a JSON object which preserves the order of its keys.
+type orderedObject struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *orderedObject) get(key string) (interface{}, bool) {
+	for n, k := range o.keys {
+		if k == key {
+			return o.values[n], true
+		}
+	}
+	return nil, false
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// structuredNode converts a value into a tree of *orderedObject, []interface{}, json.Number, string,
+// bool and nil values. visiting holds the pointers, maps and slices currently being converted so that cycles
+// are detected.
+func structuredNode(v reflect.Value, visiting map[visit]bool) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		key := visit{v.Kind(), v.Pointer()}
+		if visiting[key] {
+			return "<cycle>", nil
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+	}
+
+	if v.CanInterface() {
+		switch {
+		case v.Type().Implements(jsonMarshalerType):
+			marshaled, err := v.Interface().(json.Marshaler).MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			nodes, err := decodeStructured(marshaled)
+			if err != nil || len(nodes) != 1 {
+				return nil, fmt.Errorf("invalid JSON returned by MarshalJSON of %s", v.Type())
+			}
+			return nodes[0], nil
+		case v.Type().Implements(textMarshalerType):
+			text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+			return string(text), err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return structuredNode(v.Elem(), visiting)
+
+	case reflect.Struct:
+		v = addressable(v)
+		object := &orderedObject{}
+		for n := 0; n < v.NumField(); n++ {
+			field := v.Field(n)
+			if !field.CanInterface() {
+				field = accessible(field)
+			}
+			node, err := structuredNode(field, visiting)
+			if err != nil {
+				return nil, err
+			}
+			object.keys = append(object.keys, v.Type().Field(n).Name)
+			object.values = append(object.values, node)
+		}
+		return object, nil
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for n, key := range keys {
+			names[n] = fmt.Sprint(key.Interface())
+		}
+		sort.Sort(byName{names, keys})
+
+		object := &orderedObject{}
+		for n, key := range keys {
+			node, err := structuredNode(v.MapIndex(key), visiting)
+			if err != nil {
+				return nil, err
+			}
+			object.keys = append(object.keys, names[n])
+			object.values = append(object.values, node)
+		}
+		return object, nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Slice && utf8.Valid(v.Bytes()) {
+			return string(v.Bytes()), nil
+		}
+		elements := make([]interface{}, 0, v.Len())
+		for n := 0; n < v.Len(); n++ {
+			node, err := structuredNode(v.Index(n), visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, node)
+		}
+		return elements, nil
+
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return json.Number(strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return json.Number(strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64), nil
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, v.Type().Bits())), nil
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits()), nil
+	default:
+		// channels, functions and unsafe pointers: their addresses would change on every run
+		return "<" + v.Type().String() + ">", nil
+	}
+}
+
+// byName sorts map keys by their formatted names.
+type byName struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func (b byName) Len() int           { return len(b.names) }
+func (b byName) Less(i, j int) bool { return b.names[i] < b.names[j] }
+func (b byName) Swap(i, j int) {
+	b.names[i], b.names[j] = b.names[j], b.names[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// writeStructured writes a node as indented JSON.
+func writeStructured(w *bytes.Buffer, node interface{}, indent string, prefix string) error {
+	switch node := node.(type) {
+	case *orderedObject:
+		if len(node.keys) == 0 {
+			w.WriteString("{}")
+			return nil
+		}
+		w.WriteString("{")
+		for n, key := range node.keys {
+			if n > 0 {
+				w.WriteString(",")
+			}
+			w.WriteString("\n" + prefix + indent)
+			writeJSONString(w, key)
+			w.WriteString(": ")
+			if err := writeStructured(w, node.values[n], indent, prefix+indent); err != nil {
+				return err
+			}
+		}
+		w.WriteString("\n" + prefix + "}")
+
+	case []interface{}:
+		if len(node) == 0 {
+			w.WriteString("[]")
+			return nil
+		}
+		w.WriteString("[")
+		for n, element := range node {
+			if n > 0 {
+				w.WriteString(",")
+			}
+			w.WriteString("\n" + prefix + indent)
+			if err := writeStructured(w, element, indent, prefix+indent); err != nil {
+				return err
+			}
+		}
+		w.WriteString("\n" + prefix + "]")
+
+	case string:
+		writeJSONString(w, node)
+
+	default:
+		encoded, err := json.Marshal(node)
+		if err != nil {
+			return err
+		}
+		w.Write(encoded)
+	}
+	return nil
+}
+
+func writeJSONString(w *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)   // encoding a string cannot fail
+	w.Truncate(w.Len() - 1) // remove the newline written by Encode
+}
+
+// decodeStructured decodes a stream of JSON documents into trees of the same types returned by structuredNode.
+func decodeStructured(data []byte) ([]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var nodes []interface{}
+	for {
+		node, err := decodeStructuredNode(decoder)
+		if err == io.EOF {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+func decodeStructuredNode(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := &orderedObject{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeStructuredNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object.keys = append(object.keys, key.(string))
+			object.values = append(object.values, value)
+		}
+		_, err := decoder.Token() // the closing brace
+		return object, err
+
+	case json.Delim('['):
+		elements := []interface{}{}
+		for decoder.More() {
+			element, err := decodeStructuredNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		_, err := decoder.Token() // the closing bracket
+		return elements, err
+
+	case json.Delim('}'), json.Delim(']'):
+		return nil, fmt.Errorf("unexpected %s", token)
+	}
+
+	return token, nil
+}
+
+// formatStructured formats a node as compact JSON for use in diffs.
+func formatStructured(node interface{}) string {
+	formatted, compacted := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := writeStructured(formatted, node, "", ""); err != nil {
+		return fmt.Sprint(node)
+	}
+	if err := json.Compact(compacted, formatted.Bytes()); err != nil {
+		return formatted.String()
+	}
+	return compacted.String()
+}
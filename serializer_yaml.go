@@ -0,0 +1,108 @@
+package cupaloy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLSerializer is a Serializer which stores snapshots as YAML using gopkg.in/yaml.v3.
+// Struct fields respect `yaml` struct tags and map keys are written in sorted order.
+// Strings and byte slices containing YAML mappings or sequences (including multi-document
+// streams) are decoded and re-encoded as structured data rather than written out raw.
+// Each value (and each document of a multi-document stream) becomes a separate YAML document.
+// Snapshots taken with YAMLSerializer are stored with a .yaml file extension unless
+// SnapshotFileExtension is also configured.
+type YAMLSerializer struct {
+	// Indent is the number of spaces used to indent each level of nesting. Defaults to 2.
+	Indent int
+}
+
+// Serialize implements Serializer.
+func (s YAMLSerializer) Serialize(i ...interface{}) (string, error) {
+	snapshot := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(snapshot)
+	encoder.SetIndent(s.indent())
+
+	for _, v := range i {
+		documents, err := s.documents(v)
+		if err != nil {
+			return "", err
+		}
+
+		for _, document := range documents {
+			if err := encoder.Encode(document); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return snapshot.String(), nil
+}
+
+// FileExtension is the extension used for snapshot files written by this Serializer.
+func (s YAMLSerializer) FileExtension() string {
+	return ".yaml"
+}
+
+func (s YAMLSerializer) indent() int {
+	if s.Indent == 0 {
+		return 2
+	}
+	return s.Indent
+}
+
+// documents splits a value into the YAML documents that should be written for it.
+func (s YAMLSerializer) documents(v interface{}) ([]interface{}, error) {
+	switch vt := v.(type) {
+	case string:
+		if documents, ok := decodeYAMLStream([]byte(vt)); ok {
+			return documents, nil
+		}
+	case []byte:
+		if documents, ok := decodeYAMLStream(vt); ok {
+			return documents, nil
+		}
+		// yaml.v3 would otherwise write the bytes as a sequence of integers
+		return []interface{}{string(vt)}, nil
+	}
+
+	return []interface{}{v}, nil
+}
+
+// decodeYAMLStream decodes every document in b. It only succeeds if b is valid YAML
+// and at least one document is a mapping or sequence: plain text is also valid YAML
+// (as a single scalar) but should be snapshotted as a string.
+func decodeYAMLStream(b []byte) ([]interface{}, bool) {
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+
+	var documents []interface{}
+	structured := false
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+
+		if len(node.Content) > 0 && (node.Content[0].Kind == yaml.MappingNode || node.Content[0].Kind == yaml.SequenceNode) {
+			structured = true
+		}
+
+		var document interface{}
+		if err := node.Decode(&document); err != nil {
+			return nil, false
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, structured
+}
@@ -0,0 +1,199 @@
+package cupaloy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// Files used by the SingleFilePerTestFile layout contain every snapshot taken by one _test.go file
+// as a sequence of sections sorted by snapshot name, each starting with a header line e.g.
+//  -- TestFoo --
+//  snapshot contents...
+// Contents lines starting with "--" or "\" are escaped by prefixing them with "\" and contents not
+// ending in a newline are followed by the noNewlineMarker line.
+const (
+	singleFileExtension = ".snap"
+	singleFileComment   = "# Generated by cupaloy (github.com/bradleyjkemp/cupaloy), each section is one snapshot.\n"
+	sectionHeaderPrefix = internal.SectionHeaderPrefix
+	sectionHeaderSuffix = internal.SectionHeaderSuffix
+	escapePrefix        = internal.EscapePrefix
+	noNewlineMarker     = `\ No newline at end of snapshot`
+)
+
+// cupaloyFunctionPrefix is the prefix of the names of all functions in this package.
+var cupaloyFunctionPrefix = reflect.TypeOf(Config{}).PkgPath() + "."
+
+// snapshotSections are the snapshots stored in a single snapshot file, keyed by snapshot name.
+type snapshotSections map[string]string
+
+func parseSnapshotSections(data []byte) (snapshotSections, error) {
+	sections := snapshotSections{}
+	if len(data) == 0 {
+		return sections, nil
+	}
+
+	var name string
+	var contents *strings.Builder
+	finishSection := func() {
+		if contents != nil {
+			sections[name] = contents.String()
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for n, line := range lines {
+		switch {
+		case strings.HasPrefix(line, sectionHeaderPrefix) && strings.HasSuffix(line, sectionHeaderSuffix) &&
+			len(line) >= len(sectionHeaderPrefix)+len(sectionHeaderSuffix):
+			finishSection()
+			name = line[len(sectionHeaderPrefix) : len(line)-len(sectionHeaderSuffix)]
+			if _, duplicate := sections[name]; duplicate {
+				return nil, fmt.Errorf("line %d: snapshot %q appears more than once", n+1, name)
+			}
+			contents = &strings.Builder{}
+
+		case contents == nil:
+			// comments are allowed before the first section
+			if line != "" && !strings.HasPrefix(line, "#") {
+				return nil, fmt.Errorf("line %d: expected a %q header line", n+1, sectionHeaderPrefix+"name"+sectionHeaderSuffix)
+			}
+
+		case line == noNewlineMarker:
+			trimmed := strings.TrimSuffix(contents.String(), "\n")
+			contents.Reset()
+			contents.WriteString(trimmed)
+
+		case strings.HasPrefix(line, escapePrefix):
+			contents.WriteString(line[len(escapePrefix):] + "\n")
+
+		default:
+			contents.WriteString(line + "\n")
+		}
+	}
+	finishSection()
+
+	return sections, nil
+}
+
+func (s snapshotSections) encode() []byte {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	encoded := &bytes.Buffer{}
+	encoded.WriteString(singleFileComment)
+	for _, name := range names {
+		encoded.WriteString(sectionHeaderPrefix + name + sectionHeaderSuffix + "\n")
+
+		contents := s[name]
+		if contents == "" {
+			continue
+		}
+		for _, line := range strings.SplitAfter(contents, "\n") {
+			if line == "" {
+				// after the final newline
+				continue
+			}
+			if strings.HasPrefix(line, "--") || strings.HasPrefix(line, escapePrefix) {
+				encoded.WriteString(escapePrefix)
+			}
+			encoded.WriteString(line)
+		}
+		if !strings.HasSuffix(contents, "\n") {
+			encoded.WriteString("\n" + noNewlineMarker + "\n")
+		}
+	}
+
+	return encoded.Bytes()
+}
+
+// readSnapshotSections reads a single snapshot file from store, returning an error satisfying
+// errors.Is(err, os.ErrNotExist) if it doesn't exist.
+func readSnapshotSections(store Store, snapshotFile string) (snapshotSections, error) {
+	buf, err := store.Read(snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := parseSnapshotSections(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot file %s: %s", snapshotFile, err)
+	}
+	return sections, nil
+}
+
+// readSnapshotSection reads a single snapshot out of a single snapshot file.
+func readSnapshotSection(store Store, snapshotFile string, snapshotName string) (string, error) {
+	sections, err := readSnapshotSections(store, snapshotFile)
+	if err != nil {
+		return "", err
+	}
+
+	snapshot, ok := sections[snapshotName]
+	if !ok {
+		return "", &os.PathError{Op: "read snapshot " + snapshotName, Path: snapshotFile, Err: os.ErrNotExist}
+	}
+	return snapshot, nil
+}
+
+// writeSnapshotSection merges a snapshot into a single snapshot file (creating it if needed).
+// The caller must hold the lock on the snapshot file.
+func writeSnapshotSection(store Store, snapshotFile string, snapshotName string, snapshot string) error {
+	if strings.Contains(snapshotName, "\n") {
+		return fmt.Errorf("snapshot name %q cannot contain a newline when using SingleFilePerTestFile", snapshotName)
+	}
+
+	sections, err := readSnapshotSections(store, snapshotFile)
+	if errors.Is(err, os.ErrNotExist) {
+		sections = snapshotSections{}
+	} else if err != nil {
+		return err
+	}
+
+	sections[snapshotName] = snapshot
+	return store.Write(snapshotFile, sections.encode())
+}
+
+// singleSnapshotFileName returns the name of the snapshot file holding all the snapshots taken by
+// the _test.go file which is currently calling into cupaloy.
+func singleSnapshotFileName() string {
+	testFile := callingTestFrame().File
+	if testFile == "" {
+		testFile = "unknown_test.go"
+	}
+	return strings.TrimSuffix(filepath.Base(testFile), ".go") + singleFileExtension
+}
+
+// callingTestFrame finds the caller of cupaloy by walking up the stack: preferring the first call from
+// a _test.go file so that helper functions in non-test files are attributed to the tests calling them.
+func callingTestFrame() runtime.Frame {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	var firstCaller runtime.Frame
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, cupaloyFunctionPrefix) {
+			if strings.HasSuffix(frame.File, "_test.go") {
+				return frame
+			}
+			if firstCaller.File == "" {
+				firstCaller = frame
+			}
+		}
+		if !more {
+			return firstCaller
+		}
+	}
+}
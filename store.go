@@ -0,0 +1,150 @@
+package cupaloy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store persists snapshot files. Files are identified by slash-separated names relative to the
+// store e.g. "TestFoo", "TestFoo.json" or "foo_test.snap" (see SingleFilePerTestFile).
+// Pending snapshots (see EnvVariableName) are stored alongside as e.g. "TestFoo.new".
+type Store interface {
+	// Read returns the contents of a file or an error satisfying errors.Is(err, os.ErrNotExist)
+	// if it doesn't exist.
+	Read(name string) ([]byte, error)
+
+	// Write creates or replaces a file.
+	Write(name string, data []byte) error
+
+	// List returns the (sorted) names of all files in the store. It is used to find obsolete snapshots (see Run).
+	List() ([]string, error)
+
+	// Delete removes a file.
+	Delete(name string) error
+}
+
+// errReadOnlyStore is returned when attempting to modify a read-only store.
+var errReadOnlyStore = errors.New("snapshot store is read-only")
+
+// dirStore is the default Store which keeps snapshot files in a directory on the filesystem.
+type dirStore struct {
+	dir string
+}
+
+func (s dirStore) path(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+func (s dirStore) Read(name string) ([]byte, error) {
+	return ioutil.ReadFile(s.path(name))
+}
+
+func (s dirStore) Write(name string, data []byte) error {
+	// check that subdirectory exists before writing snapshot
+	err := os.MkdirAll(filepath.Dir(s.path(name)), os.ModePerm)
+	if err != nil {
+		return errors.New("could not create snapshots directory")
+	}
+
+	return writeFileAtomic(s.path(name), data)
+}
+
+func (s dirStore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.Mode().IsRegular() && !strings.HasPrefix(file.Name(), tempFilePrefix) {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s dirStore) Delete(name string) error {
+	return os.Remove(s.path(name))
+}
+
+// memoryStore is a Store which keeps snapshot files in memory.
+type memoryStore struct {
+	sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemoryStore returns a Store which keeps snapshots in memory rather than on the filesystem.
+// This allows tests of code built on cupaloy to run hermetically e.g.
+//  snapshotter := cupaloy.New(cupaloy.WithStore(cupaloy.NewMemoryStore()))
+func NewMemoryStore() Store {
+	return &memoryStore{files: map[string][]byte{}}
+}
+
+func (s *memoryStore) Read(name string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	data, ok := s.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *memoryStore) Write(name string, data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *memoryStore) List() ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *memoryStore) Delete(name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(s.files, name)
+	return nil
+}
+
+// getStore returns the configured Store, defaulting to the snapshot subdirectory if none has been set
+func (c *Config) getStore() Store {
+	if c.store != nil {
+		return c.store
+	}
+
+	return dirStore{dir: c.subDirName}
+}
+
+// storePath returns the path used to refer to a file in the configured store: the path on the filesystem
+// for the default store and the name of the file otherwise.
+func (c *Config) storePath(name string) string {
+	if store, ok := c.getStore().(dirStore); ok {
+		return store.path(name)
+	}
+	return name
+}
@@ -0,0 +1,48 @@
+package cupaloy
+
+import (
+	"io/fs"
+)
+
+// fsStore is a read-only Store reading snapshot files from an fs.FS.
+type fsStore struct {
+	fsys fs.FS
+}
+
+// NewFSStore returns a read-only Store which reads snapshots from the root of fsys. This allows snapshots
+// to be embedded in a test binary e.g.
+//  //go:embed .snapshots
+//  var snapshots embed.FS
+//  snapshotsDir, _ := fs.Sub(snapshots, ".snapshots")
+//  snapshotter := cupaloy.New(cupaloy.WithStore(cupaloy.NewFSStore(snapshotsDir)))
+// Attempting to create or update a snapshot in the store returns an error.
+func NewFSStore(fsys fs.FS) Store {
+	return fsStore{fsys: fsys}
+}
+
+func (s fsStore) Read(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s fsStore) Write(name string, data []byte) error {
+	return &fs.PathError{Op: "write", Path: name, Err: errReadOnlyStore}
+}
+
+func (s fsStore) List() ([]string, error) {
+	entries, err := fs.ReadDir(s.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s fsStore) Delete(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errReadOnlyStore}
+}
@@ -0,0 +1,33 @@
+package cupaloy
+
+import (
+	"os"
+	"strconv"
+)
+
+// strictEnvVariable is the environment variable which controls strict mode. In strict mode snapshots are never
+// created, updated or otherwise written to the filesystem (whatever the Config says) so tests can't modify the
+// working tree in CI. Other stores (e.g. NewMemoryStore) are unaffected.
+// Strict mode is enabled by default when the CI environment variable is true (as set by most CI systems) and
+// the strict environment variable is unset or empty.
+const strictEnvVariable = "CUPALOY_STRICT"
+
+// strictMode checks whether writing snapshots is forbidden.
+func strictMode() bool {
+	// an empty value is treated as unset
+	if value := os.Getenv(strictEnvVariable); value != "" {
+		strict, err := strconv.ParseBool(value)
+		// anything other than an explicit false value enables strict mode
+		return err != nil || strict
+	}
+
+	ci, _ := strconv.ParseBool(os.Getenv("CI"))
+	return ci
+}
+
+// strict checks whether writing snapshots to the configured store is forbidden: only the default store
+// (the filesystem) is protected by strict mode.
+func (c *Config) strict() bool {
+	_, onFilesystem := c.getStore().(dirStore)
+	return onFilesystem && strictMode()
+}
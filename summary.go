@@ -0,0 +1,159 @@
+package cupaloy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bradleyjkemp/cupaloy/v2/internal"
+)
+
+// summaryJSONEnvVariable is the environment variable which, when set to the path of a file, causes Run to
+// append the snapshot summary of the package to that file as a line of JSON.
+const summaryJSONEnvVariable = "CUPALOY_SUMMARY_JSON"
+
+// snapshotSummary counts the outcomes of every snapshot taken during this test run.
+type snapshotSummary struct {
+	Package  string `json:"package"`
+	Passed   int    `json:"passed"`
+	PassedV1 int    `json:"passedV1"`
+	Written  int    `json:"written"`
+	Updated  int    `json:"updated"`
+	Failed   int    `json:"failed"`
+	Missing  int    `json:"missing"`
+	Errors   int    `json:"errors"`
+	Total    int    `json:"total"`
+}
+
+var summary = struct {
+	sync.Mutex
+	snapshotSummary
+}{}
+
+// The possible outcomes of taking a snapshot.
+const (
+	outcomePassed   = "passed"
+	outcomePassedV1 = "passedV1"
+	outcomeWritten  = "written"
+	outcomeUpdated  = "updated"
+	outcomeFailed   = "failed"
+	outcomeMissing  = "missing"
+	outcomeError    = "error"
+)
+
+// snapshotOutcome classifies the error returned by a snapshot: matchedV1 is true if the snapshot only
+// matched in the legacy (v1) format and updated is outcomeWritten or outcomeUpdated if the snapshot was
+// written (in which case, with FailOnUpdate(false), no error is returned).
+func snapshotOutcome(err error, matchedV1 bool, updated string) string {
+	switch {
+	case updated != "" && (err == nil || errors.As(err, &internal.ErrSnapshotCreated{}) ||
+		errors.As(err, &internal.ErrSnapshotUpdated{})):
+		return updated
+	case err == nil && matchedV1:
+		return outcomePassedV1
+	case err == nil:
+		return outcomePassed
+	case errors.As(err, &internal.ErrSnapshotCreated{}):
+		return outcomeWritten
+	case errors.As(err, &internal.ErrSnapshotUpdated{}):
+		return outcomeUpdated
+	case errors.As(err, &internal.ErrSnapshotMismatch{}):
+		return outcomeFailed
+	case errors.As(err, &internal.ErrNoSnapshot{}):
+		return outcomeMissing
+	default:
+		return outcomeError
+	}
+}
+
+// recordOutcome counts the outcome of a snapshot stored in snapshotFile and reports it (see reportSnapshot).
+func (c *Config) recordOutcome(snapshotName string, snapshotFile string, err error, matchedV1 bool, updated string) {
+	outcome := snapshotOutcome(err, matchedV1, updated)
+	test := callingTestFrame().Function
+
+	summary.Lock()
+	if summary.Package == "" {
+		summary.Package = functionPackage(test)
+	}
+	summary.Total++
+	switch outcome {
+	case outcomePassed:
+		summary.Passed++
+	case outcomePassedV1:
+		summary.PassedV1++
+	case outcomeWritten:
+		summary.Written++
+	case outcomeUpdated:
+		summary.Updated++
+	case outcomeFailed:
+		summary.Failed++
+	case outcomeMissing:
+		summary.Missing++
+	default:
+		summary.Errors++
+	}
+	summary.Unlock()
+
+	if c.updateVariable != "" {
+		recordUpdatePatterns(c.updateVariable, snapshotName)
+	}
+	c.reportSnapshot(snapshotName, snapshotFile, test, outcome, err)
+}
+
+// functionPackage returns the import path of the package of a function as named by runtime.Frame
+// e.g. "github.com/foo/bar_test.TestBaz" is in package "github.com/foo/bar".
+func functionPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	return strings.TrimSuffix(function[:slash+1+dot], "_test")
+}
+
+// reportSummary prints a summary of the snapshots taken during this test run (if any) e.g.
+//  cupaloy: Snapshots: 3 updated, 1 written, 2 failed, 410 passed
+func reportSummary(w io.Writer) {
+	summary.Lock()
+	defer summary.Unlock()
+
+	if summary.Total == 0 {
+		return
+	}
+
+	var counts []string
+	for _, count := range []struct {
+		n     int
+		label string
+	}{
+		{summary.Updated, "updated"},
+		{summary.Written, "written"},
+		{summary.Failed, "failed"},
+		{summary.Missing, "missing"},
+		{summary.Errors, "errored"},
+		{summary.PassedV1, "passed in the v1 format"},
+		{summary.Passed, "passed"},
+	} {
+		if count.n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count.n, count.label))
+		}
+	}
+	fmt.Fprintf(w, "cupaloy: Snapshots: %s\n", strings.Join(counts, ", "))
+}
+
+// writeSummaryJSON appends the summary of this test run as a line of JSON to the file named by the
+// CUPALOY_SUMMARY_JSON environment variable (if set). As go test runs each package's tests separately
+// (and in the package's directory), the file receives one line per package and should be an absolute path.
+func writeSummaryJSON() error {
+	path := os.Getenv(summaryJSONEnvVariable)
+	if path == "" {
+		return nil
+	}
+
+	summary.Lock()
+	defer summary.Unlock()
+	return appendJSONLine(path, summary.snapshotSummary)
+}
@@ -0,0 +1,114 @@
+package cupaloy
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// cupaloyTag is a parsed `cupaloy:"..."` struct tag which controls how a field is snapshotted:
+//  Field string `cupaloy:"-"`             // the field is left out of snapshots
+//  Field string `cupaloy:"redact"`        // the field's value is replaced by a placeholder
+//  Field string `cupaloy:"Name"`          // the field is renamed to Name
+//  Field string `cupaloy:"Name,redact"`   // the field is renamed and redacted
+type cupaloyTag struct {
+	skip   bool
+	redact bool
+	name   string
+}
+
+func parseCupaloyTag(tag string) cupaloyTag {
+	if tag == "-" {
+		return cupaloyTag{skip: true}
+	}
+
+	parts := strings.Split(tag, ",")
+	parsed := cupaloyTag{name: parts[0]}
+	if parsed.name == "redact" {
+		return cupaloyTag{redact: true}
+	}
+	for _, option := range parts[1:] {
+		if option == "redact" {
+			parsed.redact = true
+		}
+	}
+	return parsed
+}
+
+// renameField returns a copy of field (declared in package pkgPath) with the given name.
+// Structured serializers use the json and yaml struct tags to name fields so these are renamed too.
+func renameField(field reflect.StructField, name string, pkgPath string) reflect.StructField {
+	if !token.IsIdentifier(name) {
+		panic(fmt.Sprintf("cupaloy struct tag on field %s: %q is not a valid field name", field.Name, name))
+	}
+
+	field.Name = name
+	if token.IsExported(name) {
+		field.PkgPath = ""
+	} else if field.PkgPath == "" {
+		// unexported fields must record the package they were declared in
+		field.PkgPath = pkgPath
+		if field.PkgPath == "" {
+			field.PkgPath = reflect.TypeOf(Config{}).PkgPath()
+		}
+	}
+
+	var renamedTags []string
+	for _, key := range []string{"json", "yaml"} {
+		options := ""
+		if value, ok := field.Tag.Lookup(key); ok {
+			if value == "-" {
+				renamedTags = append(renamedTags, fmt.Sprintf(`%s:"-"`, key))
+				continue
+			}
+			if i := strings.Index(value, ","); i >= 0 {
+				options = value[i:]
+			}
+		}
+		renamedTags = append(renamedTags, fmt.Sprintf(`%s:"%s%s"`, key, name, options))
+	}
+	field.Tag = reflect.StructTag(strings.Join(renamedTags, " "))
+
+	return field
+}
+
+// taggedTypes caches whether values of a type may contain fields with cupaloy struct tags.
+var taggedTypes sync.Map // map[reflect.Type]bool
+
+// mayHaveTaggedFields reports whether values of type t may contain fields with cupaloy struct tags
+// (and so need to be walked when taking a snapshot).
+func mayHaveTaggedFields(t reflect.Type) bool {
+	if tagged, ok := taggedTypes.Load(t); ok {
+		return tagged.(bool)
+	}
+
+	tagged := typeHasTaggedFields(t, map[reflect.Type]bool{})
+	taggedTypes.Store(t, tagged)
+	return tagged
+}
+
+func typeHasTaggedFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		// recursive type: the rest of the type is checked further up the stack
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Interface:
+		// the dynamic value could be of any type
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return typeHasTaggedFields(t.Elem(), seen)
+	case reflect.Struct:
+		for n := 0; n < t.NumField(); n++ {
+			field := t.Field(n)
+			if _, hasTag := field.Tag.Lookup("cupaloy"); hasTag || typeHasTaggedFields(field.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package cupaloy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// updateSelected checks whether the value of the UPDATE_SNAPSHOTS environment variable selects a snapshot
+// for updating. Values such as "true" or "1" select every snapshot, while other values are treated as a
+// comma separated list of patterns (see path.Match) matching snapshot names e.g. "TestParser*,TestRender/html".
+// As in snapshot names, "/" in patterns matches "-". A pattern matching a snapshot name also matches
+// the snapshots of its sub-tests and any numbered snapshots e.g. "TestRender" matches "TestRender-html"
+// and "TestRender-2".
+func updateSelected(value string, snapshotName string) bool {
+	if selected, ok := updateKeyword(value); ok {
+		return selected
+	}
+
+	for _, pattern := range updatePatterns(value) {
+		if patternMatches(pattern, snapshotName) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateKeyword checks whether the value of the UPDATE_SNAPSHOTS environment variable is one of the values
+// that select every snapshot, or none, rather than a list of patterns.
+func updateKeyword(value string) (selected bool, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case pendingEnvValue, migrateEnvValue, "0", "false", "no", "off":
+		return false, true
+	case "", "1", "true", "yes", "on", "all", pruneEnvValue:
+		return true, true
+	}
+	return false, false
+}
+
+// updatePatterns returns the patterns in the value of the UPDATE_SNAPSHOTS environment variable.
+func updatePatterns(value string) []string {
+	if _, ok := updateKeyword(value); ok {
+		return nil
+	}
+
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func patternMatches(pattern string, snapshotName string) bool {
+	pattern = strings.Replace(pattern, "/", "-", -1)
+	if matched, _ := path.Match(pattern, snapshotName); matched {
+		return true
+	}
+	matched, _ := path.Match(pattern+"-*", snapshotName)
+	return matched
+}
+
+// matchedUpdatePatterns records, for each environment variable used to select snapshots for updating, whether
+// each of its patterns matched any of the snapshots taken so that Run can warn about those which didn't.
+var matchedUpdatePatterns = struct {
+	sync.Mutex
+	variables map[string]map[string]bool
+}{variables: map[string]map[string]bool{}}
+
+// recordUpdatePatterns records which of the patterns set in an environment variable match a snapshot.
+func recordUpdatePatterns(variable string, snapshotName string) {
+	patterns := updatePatterns(os.Getenv(variable))
+	if len(patterns) == 0 {
+		return
+	}
+
+	matchedUpdatePatterns.Lock()
+	defer matchedUpdatePatterns.Unlock()
+	matched, ok := matchedUpdatePatterns.variables[variable]
+	if !ok {
+		matched = map[string]bool{}
+		matchedUpdatePatterns.variables[variable] = matched
+	}
+	for _, pattern := range patterns {
+		matched[pattern] = matched[pattern] || patternMatches(pattern, snapshotName)
+	}
+}
+
+// reportUnmatchedUpdatePatterns warns about patterns which don't contain any wildcards and didn't match any
+// snapshot e.g.
+//  cupaloy: UPDATE_SNAPSHOTS=y didn't match any snapshots: set UPDATE_SNAPSHOTS=true to update every snapshot
+// As setting UPDATE_SNAPSHOTS to any value used to update every snapshot, these are likely to be values
+// such as "y" or "always" which were intended to do so.
+func reportUnmatchedUpdatePatterns(w io.Writer) {
+	matchedUpdatePatterns.Lock()
+	defer matchedUpdatePatterns.Unlock()
+
+	var unmatched []string
+	for variable, matched := range matchedUpdatePatterns.variables {
+		for pattern := range matched {
+			if !matched[pattern] && !strings.ContainsAny(pattern, `*?[\`) {
+				unmatched = append(unmatched, fmt.Sprintf(
+					"cupaloy: %s=%s didn't match any snapshots: set %s=true to update every snapshot\n", variable, pattern, variable))
+			}
+		}
+	}
+	sort.Strings(unmatched)
+	for _, warning := range unmatched {
+		fmt.Fprint(w, warning)
+	}
+}
@@ -1,18 +1,13 @@
 package cupaloy
 
 import (
-	"bytes"
 	"errors"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/bradleyjkemp/cupaloy/v2/internal"
-
-	"github.com/davecgh/go-spew/spew"
-	"github.com/pmezard/go-difflib/difflib"
 )
 
 //go:generate $GOPATH/bin/mockery -output=examples -outpkg=examples_test -testonly -name=TestingT
@@ -39,73 +34,114 @@ func envVariableSet(envVariable string) bool {
 	return varSet
 }
 
-func (c *Config) getSpewConfig() *spew.ConfigState {
-	return &spew.ConfigState{
-		Indent:                  "  ",
-		SortKeys:                true, // maps should be spewed in a deterministic order
-		DisablePointerAddresses: true, // don't spew the addresses of pointers
-		DisableCapacities:       true, // don't spew capacities of collections
-		SpewKeys:                true, // if unable to sort map keys then spew keys to strings and sort those
-		DisableMethods:          !c.useStringerMethods,
+// snapshotFileName returns the name of the file (in the configured Store) containing a snapshot.
+func (c *Config) snapshotFileName(testName string) string {
+	if c.singleFilePerTestFile {
+		return singleSnapshotFileName()
 	}
+	return testName + c.fileExtension()
 }
 
 func (c *Config) snapshotFilePath(testName string) string {
-	return filepath.Join(c.subDirName, testName+c.snapshotFileExtension)
+	return c.storePath(c.snapshotFileName(testName))
 }
 
-// Legacy snapshot format where all items were spewed
-func (c *Config) takeV1Snapshot(i ...interface{}) string {
-	return c.getSpewConfig().Sdump(i...)
+func (c *Config) fileExtension() string {
+	if c.snapshotFileExtensionSet {
+		return c.snapshotFileExtension
+	}
+
+	if serializer, ok := c.getSerializer().(fileExtensioner); ok {
+		return serializer.FileExtension()
+	}
+
+	return ""
 }
 
-// New snapshot format where some types are written out raw to the file
-func (c *Config) takeSnapshot(i ...interface{}) string {
-	snapshot := &bytes.Buffer{}
-	for _, v := range i {
-		switch vt := v.(type) {
-		case string:
-			snapshot.WriteString(vt)
-			snapshot.WriteString("\n")
-		case []byte:
-			snapshot.Write(vt)
-			snapshot.WriteString("\n")
-		default:
-			c.getSpewConfig().Fdump(snapshot, v)
-		}
+// getSerializer returns the configured Serializer, defaulting to spew if none has been set
+func (c *Config) getSerializer() Serializer {
+	if c.serializer != nil {
+		return c.serializer
 	}
 
-	return snapshot.String()
+	return SpewSerializer{UseStringerMethods: c.useStringerMethods, HexDumpBytes: c.hexDumpBytes}
 }
 
-func (c *Config) readSnapshot(snapshotName string) (string, error) {
-	snapshotFile := c.snapshotFilePath(snapshotName)
-	buf, err := ioutil.ReadFile(snapshotFile)
+// usesSpewSerializer reports whether snapshots are taken using the default spew based format
+func (c *Config) usesSpewSerializer() bool {
+	_, isSpew := c.getSerializer().(SpewSerializer)
+	return isSpew
+}
 
-	if os.IsNotExist(err) {
-		return "", err
-	}
+// Legacy snapshot format where all items were spewed
+func (c *Config) takeV1Snapshot(i ...interface{}) string {
+	redacted, types := c.redactor.redact(i, false, c.useStringerMethods)
+	return c.scrub(types.restore(SpewSerializer{UseStringerMethods: c.useStringerMethods}.spewConfig().Sdump(redacted...)))
+}
 
+// Legacy snapshot format where byte slices were always written raw (even if they weren't valid UTF-8)
+func (c *Config) takeRawBytesSnapshot(i ...interface{}) string {
+	rawBytes := func([]byte) bool { return false }
+	redacted, types := c.redactor.redact(i, false, c.useStringerMethods)
+	return c.scrub(types.restore(SpewSerializer{UseStringerMethods: c.useStringerMethods}.serialize(rawBytes, redacted...)))
+}
+
+// New snapshot format where values are converted to text by the configured Serializer
+func (c *Config) takeSnapshot(i ...interface{}) (string, error) {
+	spew, usesSpew := c.getSerializer().(SpewSerializer)
+	redacted, types := c.redactor.redact(i, !usesSpew, usesSpew && spew.UseStringerMethods)
+	snapshot, err := c.getSerializer().Serialize(redacted...)
 	if err != nil {
 		return "", err
 	}
+	if usesSpew {
+		snapshot = types.restore(snapshot)
+	}
 
-	return string(buf), nil
+	return c.scrub(snapshot), nil
 }
 
-func (c *Config) updateSnapshot(snapshotName string, prevSnapshot string, snapshot string) error {
-	// check that subdirectory exists before writing snapshot
-	err := os.MkdirAll(c.subDirName, os.ModePerm)
-	if err != nil {
-		return errors.New("could not create snapshots directory")
+// readSnapshot returns the contents of a snapshot along with its header (or nil if it has none).
+func (c *Config) readSnapshot(snapshotName string) (string, *internal.SnapshotHeader, error) {
+	snapshotFile := c.snapshotFileName(snapshotName)
+	var stored string
+	if c.singleFilePerTestFile {
+		section, err := readSnapshotSection(c.getStore(), snapshotFile, snapshotName)
+		if err != nil {
+			return "", nil, err
+		}
+		stored = section
+	} else {
+		buf, err := c.getStore().Read(snapshotFile)
+		if err != nil {
+			return "", nil, err
+		}
+		stored = string(buf)
 	}
 
+	header, snapshot := internal.ParseSnapshotHeader(stored)
+	return snapshot, header, nil
+}
+
+// writeSnapshot stores a snapshot (with a header if configured).
+func (c *Config) writeSnapshot(snapshotName string, snapshot string) error {
+	stored := c.encodeSnapshot(snapshot)
+	if c.singleFilePerTestFile {
+		return writeSnapshotSection(c.getStore(), c.snapshotFileName(snapshotName), snapshotName, stored)
+	}
+	return c.getStore().Write(c.snapshotFileName(snapshotName), []byte(stored))
+}
+
+func (c *Config) updateSnapshot(snapshotName string, prevSnapshot string, snapshot string) error {
 	snapshotFile := c.snapshotFilePath(snapshotName)
-	_, err = os.Stat(snapshotFile)
-	isNewSnapshot := os.IsNotExist(err)
+	_, _, err := c.readSnapshot(snapshotName)
+	isNewSnapshot := errors.Is(err, os.ErrNotExist)
 
-	err = ioutil.WriteFile(snapshotFile, []byte(snapshot), os.FileMode(0644))
-	if err != nil {
+	if err := c.writeSnapshot(snapshotName, snapshot); err != nil {
+		return err
+	}
+
+	if err := c.removeFullDiff(snapshotName); err != nil {
 		return err
 	}
 
@@ -114,31 +150,40 @@ func (c *Config) updateSnapshot(snapshotName string, prevSnapshot string, snapsh
 		return nil
 	}
 
-	snapshotDiff := c.diffSnapshots(prevSnapshot, snapshot)
+	// the full diff of an update can be seen using version control so isn't written to a file
+	snapshotDiff, summary := truncateDiff(c.diff(prevSnapshot, snapshot), c.maxDiffSize)
+	if summary != "" {
+		snapshotDiff += "... " + summary + "\n"
+	}
 
 	if isNewSnapshot {
 		return internal.ErrSnapshotCreated{
 			Name:     snapshotName,
+			FilePath: snapshotFile,
 			Contents: snapshot,
+			Current:  snapshot,
 		}
 	}
 
 	return internal.ErrSnapshotUpdated{
-		Name: snapshotName,
-		Diff: snapshotDiff,
+		Name:     snapshotName,
+		FilePath: snapshotFile,
+		Diff:     snapshotDiff,
+		Previous: prevSnapshot,
+		Current:  snapshot,
 	}
 }
 
-func diffSnapshots(previous, current string) string {
-	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-		A:        difflib.SplitLines(previous),
-		B:        difflib.SplitLines(current),
-		FromFile: "Previous",
-		FromDate: "",
-		ToFile:   "Current",
-		ToDate:   "",
-		Context:  1,
-	})
-
-	return diff
+// diff displays the difference between two snapshots using the configured differ, defaulting to the
+// Serializer's differ if it has one and difflib otherwise
+func (c *Config) diff(previous, current string) string {
+	if c.diffSnapshots != nil {
+		return c.diffSnapshots(previous, current, c.diffContextLines)
+	}
+
+	if serializer, ok := c.getSerializer().(snapshotDiffer); ok {
+		return serializer.Diff(previous, current, c.diffContextLines)
+	}
+
+	return internal.Diff(previous, current, c.diffContextLines)
 }